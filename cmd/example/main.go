@@ -8,12 +8,14 @@ import (
 	"os"
 	"time"
 
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/flow"
 	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
 	nodered "github.com/yoyo-mq/go-nodered-wrapper/pkg/wrapper"
 )
 
 func main() {
 	var (
+		configPath = flag.String("config", "", "Config file (see configs/config.yaml); overrides the other connection flags")
 		nodeRedURL = flag.String("url", "http://localhost:1880", "Node-RED URL")
 		apiKey     = flag.String("key", "", "Node-RED API key")
 		timeout    = flag.Duration("timeout", 30*time.Second, "Request timeout")
@@ -30,6 +32,13 @@ func main() {
 		Timeout:    *timeout,
 		Debug:      *debug,
 	}
+	if *configPath != "" {
+		loaded, err := nodered.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatal("Failed to load config:", err)
+		}
+		config = loaded
+	}
 
 	// Create wrapper instance
 	wrapper, err := nodered.New(config)
@@ -47,8 +56,8 @@ func main() {
 		fmt.Println("✅ Node-RED is healthy!")
 
 	case "deploy":
-		flow := createExampleFlow(*flowID)
-		if err := wrapper.DeployFlow(ctx, flow); err != nil {
+		def := createExampleFlow(*flowID)
+		if err := wrapper.DeployFlow(ctx, def, nodered.WithExecutionEndpoint(nodered.ExecutionEndpoint{})); err != nil {
 			log.Fatal("Failed to deploy flow:", err)
 		}
 		fmt.Printf("✅ Flow '%s' deployed successfully!\n", *flowID)
@@ -65,14 +74,14 @@ func main() {
 		fmt.Printf("✅ Flow executed successfully! Result: %+v\n", result)
 
 	case "get":
-		flow, err := wrapper.GetFlow(ctx, *flowID)
+		def, err := wrapper.GetFlow(ctx, *flowID)
 		if err != nil {
 			log.Fatal("Failed to get flow:", err)
 		}
-		fmt.Printf("✅ Retrieved flow: %s - %s\n", flow.ID, flow.Name)
-		fmt.Printf("   Description: %s\n", flow.Description)
-		fmt.Printf("   Nodes: %d\n", len(flow.Nodes))
-		fmt.Printf("   Connections: %d\n", len(flow.Connections))
+		fmt.Printf("✅ Retrieved flow: %s - %s\n", def.ID, def.Name)
+		fmt.Printf("   Description: %s\n", def.Description)
+		fmt.Printf("   Nodes: %d\n", len(def.Nodes))
+		fmt.Printf("   Connections: %d\n", len(def.Connections))
 
 	case "delete":
 		if err := wrapper.DeleteFlow(ctx, *flowID); err != nil {
@@ -88,68 +97,23 @@ func main() {
 }
 
 func createExampleFlow(flowID string) *types.FlowDefinition {
-	return &types.FlowDefinition{
-		ID:          flowID,
-		Name:        "CLI Example Flow",
-		Description: "A simple flow created from the CLI",
-		Version:     "1.0.0",
-		Nodes: []types.Node{
-			{
-				ID:   "inject-1",
-				Type: "inject",
-				Name: "Start",
-				Position: types.Position{
-					X: 100,
-					Y: 100,
-				},
-				Wires: [][]string{{"function-1"}},
-				Properties: map[string]interface{}{
-					"payload":     "",
-					"payloadType": "json",
-				},
-			},
-			{
-				ID:   "function-1",
-				Type: "function",
-				Name: "Process",
-				Position: types.Position{
-					X: 300,
-					Y: 100,
-				},
-				Wires: [][]string{{"debug-1"}},
-				Properties: map[string]interface{}{
-					"func": `
+	def, err := flow.New(flowID).
+		Name("CLI Example Flow").
+		Description("A simple flow created from the CLI").
+		Start(flow.Inject().Named("Start").At(100, 100).With("payloadType", "json")).
+		Then(flow.Function(`
 msg.payload = {
     message: "Processed: " + msg.payload.message,
     timestamp: msg.payload.timestamp,
     processed_at: new Date().toISOString()
 };
-return msg;`,
-				},
-			},
-			{
-				ID:   "debug-1",
-				Type: "debug",
-				Name: "Log",
-				Position: types.Position{
-					X: 500,
-					Y: 100,
-				},
-				Wires: [][]string{},
-				Properties: map[string]interface{}{
-					"complete": "payload",
-				},
-			},
-		},
-		Connections: []types.Connection{
-			{
-				Source: "inject-1",
-				Target: "function-1",
-			},
-			{
-				Source: "function-1",
-				Target: "debug-1",
-			},
-		},
+return msg;`).Named("Process").At(300, 100)).
+		Then(flow.Debug().Named("Log").At(500, 100)).
+		Build()
+	if err != nil {
+		log.Fatal("Failed to build flow:", err)
 	}
+
+	def.Version = "1.0.0"
+	return def
 }
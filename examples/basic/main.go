@@ -49,18 +49,31 @@ func main() {
 					X: 100,
 					Y: 100,
 				},
-				Wires: [][]string{{"debug-1"}},
+				Wires: [][]string{{"function-1"}},
 				Properties: map[string]interface{}{
 					"payload":     "Hello World",
 					"payloadType": "str",
 				},
 			},
+			{
+				ID:   "function-1",
+				Type: "function",
+				Name: "Echo",
+				Position: types.Position{
+					X: 300,
+					Y: 100,
+				},
+				Wires: [][]string{{"debug-1"}},
+				Properties: map[string]interface{}{
+					"func": "msg.payload = { echo: msg.payload };\nreturn msg;",
+				},
+			},
 			{
 				ID:   "debug-1",
 				Type: "debug",
 				Name: "Log",
 				Position: types.Position{
-					X: 300,
+					X: 500,
 					Y: 100,
 				},
 				Wires: [][]string{},
@@ -72,14 +85,18 @@ func main() {
 		Connections: []types.Connection{
 			{
 				Source: "inject-1",
+				Target: "function-1",
+			},
+			{
+				Source: "function-1",
 				Target: "debug-1",
 			},
 		},
 	}
 
-	// Deploy the flow
+	// Deploy the flow with an HTTP endpoint so it can be executed
 	log.Println("Deploying flow...")
-	if err := wrapper.DeployFlow(ctx, flow); err != nil {
+	if err := wrapper.DeployFlow(ctx, flow, nodered.WithExecutionEndpoint(nodered.ExecutionEndpoint{})); err != nil {
 		log.Fatal("Failed to deploy flow:", err)
 	}
 	log.Println("Flow deployed successfully!")
@@ -37,10 +37,12 @@ func main() {
 					"workflowId":      "yoyo-workflow-with-debug",
 					"nodeId":          "debug-node-1",
 					"yoyoEndpoint":    "http://app:8080",
-					"apiKey":          "your-yoyo-api-key",
 					"level":           "info",
 					"outputToSidebar": true,
 				},
+				Credentials: types.Credentials{
+					"apiKey": "your-yoyo-api-key",
+				},
 			},
 		},
 	}
@@ -0,0 +1,290 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+const (
+	// tokenRefreshLeeway is how long before expiry a token is proactively refreshed
+	tokenRefreshLeeway = time.Minute
+	defaultClientID    = "node-red-admin"
+	defaultScope       = "*"
+)
+
+// tokenSource holds the access token sent to Node-RED and knows how to obtain
+// a new one. Refreshes are serialized so that concurrent requests failing with
+// an expired token trigger a single re-authentication.
+type tokenSource struct {
+	mu          sync.Mutex
+	token       types.AuthToken
+	credentials types.CredentialsFunc
+	now         func() time.Time
+
+	refreshMu sync.Mutex
+}
+
+// newTokenSource returns a token source seeded with a static API key, which
+// never expires and cannot be refreshed
+func newTokenSource(apiKey string) *tokenSource {
+	return &tokenSource{
+		token: types.AuthToken{AccessToken: apiKey, TokenType: "Bearer"},
+		now:   time.Now,
+	}
+}
+
+// current returns the token to send
+func (s *tokenSource) current() types.AuthToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+func (s *tokenSource) set(token types.AuthToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+func (s *tokenSource) setCredentials(fn types.CredentialsFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials = fn
+}
+
+func (s *tokenSource) credentialsFunc() types.CredentialsFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.credentials
+}
+
+// canRefresh reports whether credentials are available to obtain a new token
+func (s *tokenSource) canRefresh() bool {
+	return s.credentialsFunc() != nil
+}
+
+// expiring reports whether the token expires within the refresh leeway
+func (s *tokenSource) expiring(token types.AuthToken) bool {
+	return !token.ExpiresAt.IsZero() && s.now().Add(tokenRefreshLeeway).After(token.ExpiresAt)
+}
+
+// clear forgets the token and the credentials used to refresh it
+func (s *tokenSource) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = types.AuthToken{}
+	s.credentials = nil
+}
+
+// token returns the access token to use for a request, refreshing it first
+// when it is about to expire
+func (c *NodeRedClient) token(ctx context.Context) (string, error) {
+	token := c.tokens.current()
+	if c.tokens.expiring(token) && c.tokens.canRefresh() {
+		return c.refreshToken(ctx, token.AccessToken)
+	}
+	return token.AccessToken, nil
+}
+
+// refreshToken re-authenticates unless another caller already replaced the
+// stale token while this one was waiting, and returns the current token
+func (c *NodeRedClient) refreshToken(ctx context.Context, stale string) (string, error) {
+	c.tokens.refreshMu.Lock()
+	defer c.tokens.refreshMu.Unlock()
+
+	if token := c.tokens.current(); token.AccessToken != stale && !c.tokens.expiring(token) {
+		return token.AccessToken, nil
+	}
+
+	credentials := c.tokens.credentialsFunc()
+	if credentials == nil {
+		return "", fmt.Errorf("failed to refresh token: no credentials available")
+	}
+
+	username, password, err := credentials(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	token, err := c.requestToken(ctx, username, password)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	c.logger.Info("refreshed node-red access token", "expires_at", token.ExpiresAt)
+
+	c.tokens.set(*token)
+	return token.AccessToken, nil
+}
+
+// AuthInfo retrieves the admin authentication scheme from GET /auth/login.
+// An instance without admin auth reports types.AuthNone.
+func (c *NodeRedClient) AuthInfo(ctx context.Context) (*types.AuthInfo, error) {
+	url := fmt.Sprintf("%s/auth/login", c.baseURL)
+
+	resp, err := c.send(ctx, "GET", url, nil, nil, sendOptions{maxRetries: c.retry.maxRetries})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth info: %w", err)
+	}
+	defer c.closeResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get auth info: %w", newAPIError(resp, nil))
+	}
+
+	var info types.AuthInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode auth info: %w", err)
+	}
+
+	return &info, nil
+}
+
+// GetAuthToken authenticates with Node-RED and returns an access token. The
+// token is used for subsequent requests, and the credentials are kept so the
+// token can be renewed before it expires or when Node-RED rejects it.
+func (c *NodeRedClient) GetAuthToken(ctx context.Context, username, password string) (string, error) {
+	c.tokens.refreshMu.Lock()
+	defer c.tokens.refreshMu.Unlock()
+
+	token, err := c.requestToken(ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+
+	c.tokens.set(*token)
+	c.tokens.setCredentials(func(context.Context) (string, string, error) {
+		return username, password, nil
+	})
+
+	return token.AccessToken, nil
+}
+
+// SetCredentialsFunc makes the client obtain credentials from fn whenever it
+// needs to authenticate again, instead of reusing those given to GetAuthToken
+func (c *NodeRedClient) SetCredentialsFunc(fn types.CredentialsFunc) {
+	c.tokens.setCredentials(fn)
+}
+
+// InheritAuth takes over the logged-in session of another client: when it
+// holds credentials, its token and credentials are copied so this client
+// keeps renewing the same session. It reports whether anything was copied.
+func (c *NodeRedClient) InheritAuth(from *NodeRedClient) bool {
+	credentials := from.tokens.credentialsFunc()
+	if credentials == nil {
+		return false
+	}
+
+	c.tokens.set(from.tokens.current())
+	c.tokens.setCredentials(credentials)
+	return true
+}
+
+// Token returns the access token currently in use and its expiry
+func (c *NodeRedClient) Token() types.AuthToken {
+	return c.tokens.current()
+}
+
+// requestToken exchanges a username and password for an access token
+func (c *NodeRedClient) requestToken(ctx context.Context, username, password string) (*types.AuthToken, error) {
+	url := fmt.Sprintf("%s/auth/token", c.baseURL)
+
+	clientID := c.clientID
+	if clientID == "" {
+		clientID = defaultClientID
+	}
+	scope := c.scope
+	if scope == "" {
+		scope = defaultScope
+	}
+
+	// Prepare authentication request payload
+	authPayload := map[string]interface{}{
+		"client_id":  clientID,
+		"grant_type": "password",
+		"scope":      scope,
+		"username":   username,
+		"password":   password,
+	}
+
+	jsonData, err := json.Marshal(authPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal auth payload: %w", err)
+	}
+
+	requestedAt := c.tokens.now()
+	resp, err := c.send(ctx, "POST", url, jsonData, nil, sendOptions{maxRetries: c.retry.maxRetries})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	defer c.closeResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authentication failed: %w", newAPIError(resp, nil))
+	}
+
+	// Parse the response to extract the access token
+	var authResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode auth response: %w", err)
+	}
+
+	if authResponse.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in auth response")
+	}
+
+	token := &types.AuthToken{
+		AccessToken: authResponse.AccessToken,
+		TokenType:   authResponse.TokenType,
+	}
+	if authResponse.ExpiresIn > 0 {
+		token.ExpiresAt = requestedAt.Add(time.Duration(authResponse.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// Logout revokes the current access token with POST /auth/revoke and forgets
+// it along with the stored credentials
+func (c *NodeRedClient) Logout(ctx context.Context) error {
+	token := c.tokens.current().AccessToken
+	if token == "" {
+		return nil
+	}
+
+	url := fmt.Sprintf("%s/auth/revoke", c.baseURL)
+
+	jsonData, err := json.Marshal(map[string]string{"token": token})
+	if err != nil {
+		return fmt.Errorf("failed to marshal revoke payload: %w", err)
+	}
+
+	// Sent without the token source so a rejected token is not refreshed just
+	// to be revoked
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.send(ctx, "POST", url, jsonData, header, sendOptions{maxRetries: c.retry.maxRetries})
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer c.closeResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to revoke token: %w", newAPIError(resp, nil))
+	}
+
+	c.tokens.clear()
+	return nil
+}
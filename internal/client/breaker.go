@@ -0,0 +1,225 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+const (
+	defaultBreakerTimeout      = 60 * time.Second
+	defaultBreakerResetTimeout = 5 * time.Minute
+	instanceBreakerKey         = "*"
+)
+
+// breakerSet holds the circuit breakers guarding calls to Node-RED, either one
+// for the whole instance or one per endpoint
+type breakerSet struct {
+	config      types.CircuitBreaker
+	perEndpoint bool
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+	onChange func(types.CircuitStateChange)
+}
+
+// newBreakerSet returns nil when the config does not enable a circuit breaker
+func newBreakerSet(config *types.Config) *breakerSet {
+	cb := config.CircuitBreaker
+	if cb == nil || cb.MaxFailures <= 0 {
+		return nil
+	}
+
+	settings := *cb
+	if settings.Timeout <= 0 {
+		settings.Timeout = defaultBreakerTimeout
+	}
+	if settings.ResetTimeout <= 0 {
+		settings.ResetTimeout = defaultBreakerResetTimeout
+	}
+
+	return &breakerSet{
+		config:      settings,
+		perEndpoint: settings.PerEndpoint,
+		breakers:    make(map[string]*circuitBreaker),
+	}
+}
+
+// get returns the breaker responsible for the given request
+func (s *breakerSet) get(method, rawURL, baseURL string) *circuitBreaker {
+	key := instanceBreakerKey
+	if s.perEndpoint {
+		key = endpointKey(method, rawURL, baseURL)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[key]
+	if !ok {
+		b = &circuitBreaker{
+			name:   key,
+			config: s.config,
+			notify: s.notify,
+			now:    time.Now,
+		}
+		s.breakers[key] = b
+	}
+	return b
+}
+
+// setListener registers the function called on every state transition
+func (s *breakerSet) setListener(fn func(types.CircuitStateChange)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// states returns the current state of every known breaker
+func (s *breakerSet) states() map[string]types.CircuitState {
+	s.mu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	states := make(map[string]types.CircuitState, len(breakers))
+	for _, b := range breakers {
+		states[b.name] = b.currentState()
+	}
+	return states
+}
+
+func (s *breakerSet) notify(change types.CircuitStateChange) {
+	s.mu.Lock()
+	fn := s.onChange
+	s.mu.Unlock()
+
+	if fn != nil {
+		fn(change)
+	}
+}
+
+// endpointKey groups requests by method and the first path segment below the
+// base URL, so that "/flow/abc" and "/flow/def" share a breaker
+func endpointKey(method, rawURL, baseURL string) string {
+	path := strings.TrimPrefix(rawURL, baseURL)
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+
+	segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	return fmt.Sprintf("%s /%s", method, segment)
+}
+
+// circuitBreaker is a closed/open/half-open breaker for a single endpoint
+type circuitBreaker struct {
+	name   string
+	config types.CircuitBreaker
+	notify func(types.CircuitStateChange)
+	now    func() time.Time
+
+	mu          sync.Mutex
+	state       types.CircuitState
+	failures    int
+	lastFailure time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+// allow reports whether a request may be sent, moving an open breaker to
+// half-open once its timeout has elapsed. Only one probe is let through while
+// half-open.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	var change *types.CircuitStateChange
+
+	switch b.state {
+	case types.CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.config.Timeout {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: %s", types.ErrCircuitOpen, b.name)
+		}
+		change = b.transition(types.CircuitHalfOpen)
+		b.probing = true
+	case types.CircuitHalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: %s", types.ErrCircuitOpen, b.name)
+		}
+		b.probing = true
+	}
+
+	b.mu.Unlock()
+	b.emit(change)
+	return nil
+}
+
+// record updates the breaker with the outcome of a request
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	var change *types.CircuitStateChange
+	now := b.now()
+
+	if success {
+		b.failures = 0
+		b.probing = false
+		if b.state != types.CircuitClosed {
+			change = b.transition(types.CircuitClosed)
+		}
+	} else {
+		if !b.lastFailure.IsZero() && now.Sub(b.lastFailure) > b.config.ResetTimeout {
+			b.failures = 0
+		}
+		b.failures++
+		b.lastFailure = now
+
+		if b.state == types.CircuitHalfOpen || b.failures >= b.config.MaxFailures {
+			b.probing = false
+			b.openedAt = now
+			if b.state != types.CircuitOpen {
+				change = b.transition(types.CircuitOpen)
+			}
+		}
+	}
+
+	b.mu.Unlock()
+	b.emit(change)
+}
+
+// release gives up a half-open probe slot without recording an outcome, used
+// when the request was abandoned (e.g. context cancelled)
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) currentState() types.CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// transition changes state; callers must hold b.mu
+func (b *circuitBreaker) transition(to types.CircuitState) *types.CircuitStateChange {
+	change := &types.CircuitStateChange{
+		Endpoint: b.name,
+		From:     b.state,
+		To:       to,
+		Time:     b.now(),
+	}
+	b.state = to
+	return change
+}
+
+func (b *circuitBreaker) emit(change *types.CircuitStateChange) {
+	if change != nil && b.notify != nil {
+		b.notify(*change)
+	}
+}
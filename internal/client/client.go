@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
 )
@@ -14,15 +17,21 @@ import (
 // NodeRedClient handles communication with Node-RED
 type NodeRedClient struct {
 	baseURL    string
+	httpURL    string
 	httpClient *http.Client
-	apiKey     string
-	debug      bool
+	execClient *http.Client // Bounded by the execution timeout instead
+	tokens     *tokenSource
+	clientID   string
+	scope      string
+	logger     types.Logger
+	retry      retryPolicy
+	breakers   *breakerSet
 }
 
 // closeResponseBody safely closes the response body and logs any errors
 func (c *NodeRedClient) closeResponseBody(resp *http.Response) {
-	if err := resp.Body.Close(); err != nil && c.debug {
-		fmt.Printf("Warning: failed to close response body: %v\n", err)
+	if err := resp.Body.Close(); err != nil {
+		c.logger.Warn("failed to close response body", "error", err)
 	}
 }
 
@@ -32,21 +41,262 @@ func NewNodeRedClient(config *types.Config) (*NodeRedClient, error) {
 		return nil, fmt.Errorf("node_red_url is required")
 	}
 
+	httpURL := config.HTTPNodeURL
+	if httpURL == "" {
+		httpURL = config.NodeRedURL
+	}
+
 	return &NodeRedClient{
 		baseURL: config.NodeRedURL,
+		httpURL: strings.TrimSuffix(httpURL, "/"),
 		httpClient: &http.Client{
 			Timeout: config.Timeout,
 		},
-		apiKey: config.APIKey,
-		debug:  config.Debug,
+		execClient: &http.Client{
+			Timeout: executionTimeout(config),
+		},
+		tokens:   newTokenSource(config.APIKey),
+		clientID: config.ClientID,
+		scope:    config.Scope,
+		logger:   newLogger(config),
+		retry:    newRetryPolicy(config),
+		breakers: newBreakerSet(config),
 	}, nil
 }
 
+// executionTimeout bounds flow executions, which may run for longer than
+// admin API requests: Execution.Timeout when set, else Timeout
+func executionTimeout(config *types.Config) time.Duration {
+	if e := config.Execution; e != nil && e.Timeout > 0 {
+		return e.Timeout
+	}
+	return config.Timeout
+}
+
+// Close releases idle connections. The client must not be used afterwards.
+func (c *NodeRedClient) Close() {
+	c.httpClient.CloseIdleConnections()
+	c.execClient.CloseIdleConnections()
+}
+
+// OnCircuitStateChange registers a function called whenever a circuit breaker
+// changes state. It is a no-op when no circuit breaker is configured.
+func (c *NodeRedClient) OnCircuitStateChange(fn func(types.CircuitStateChange)) {
+	if c.breakers != nil {
+		c.breakers.setListener(fn)
+	}
+}
+
+// CircuitStates returns the current state of each circuit breaker, keyed by
+// endpoint ("*" when a single breaker guards the whole instance)
+func (c *NodeRedClient) CircuitStates() map[string]types.CircuitState {
+	if c.breakers == nil {
+		return map[string]types.CircuitState{}
+	}
+	return c.breakers.states()
+}
+
+// newRequest builds a request against the Node-RED API with the common headers set
+func (c *NodeRedClient) newRequest(ctx context.Context, method, url string, body []byte, header http.Header, token string) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	return req, nil
+}
+
+// do sends a request to Node-RED, retrying transient failures according to the
+// client's retry policy. Network errors, 429 and 5xx responses are retried with
+// exponential backoff; any other response is returned to the caller as-is.
+// POST requests are not idempotent, so they are only resent when Node-RED
+// cannot have acted on them: after a 429 or a failure to connect. When
+// retries are exhausted the last response (or error) is returned. While the
+// circuit breaker is open, types.ErrCircuitOpen is returned without a request.
+// A 401 response triggers a single token refresh and resend when the client
+// holds credentials.
+func (c *NodeRedClient) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	return c.doRequest(ctx, method, url, body, nil, c.retry.maxRetries)
+}
+
+// doRequest is do with extra request headers and an explicit retry budget
+func (c *NodeRedClient) doRequest(ctx context.Context, method, url string, body []byte, header http.Header, maxRetries int) (*http.Response, error) {
+	return c.send(ctx, method, url, body, header, sendOptions{maxRetries: maxRetries, auth: true})
+}
+
+// sendOptions controls how send treats a request
+type sendOptions struct {
+	maxRetries int
+	// auth sends the access token, refreshing it once on a 401. Requests made
+	// on behalf of the token source itself go without it so they never
+	// recurse into it, and so do flow executions, which are not admin API
+	// requests.
+	auth bool
+	// execution marks calls of a flow's execution endpoint, whose responses
+	// come from the flow: only transport errors count against the circuit
+	// breaker
+	execution bool
+}
+
+// send is doRequest with control over authentication and failure accounting
+func (c *NodeRedClient) send(ctx context.Context, method, url string, body []byte, header http.Header, opts sendOptions) (*http.Response, error) {
+	var token string
+	if opts.auth {
+		var err error
+		if token, err = c.token(ctx); err != nil {
+			return nil, err
+		}
+	}
+	refreshed := false
+
+	var breaker *circuitBreaker
+	if c.breakers != nil {
+		breaker = c.breakers.get(method, url, c.baseURL)
+	}
+
+	idempotent := method != http.MethodPost
+	for attempt := 0; ; attempt++ {
+		if breaker != nil {
+			if err := breaker.allow(); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := c.newRequest(ctx, method, url, body, header, token)
+		if err != nil {
+			if breaker != nil {
+				breaker.release()
+			}
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		c.logger.Debug("node-red request",
+			"method", method,
+			"url", url,
+			"attempt", attempt+1,
+			"body", redactBody(body),
+		)
+
+		httpClient := c.httpClient
+		if opts.execution {
+			httpClient = c.execClient
+		}
+		start := time.Now()
+		resp, err := httpClient.Do(req)
+		latency := time.Since(start)
+		if ctx.Err() != nil {
+			if breaker != nil {
+				breaker.release()
+			}
+			if resp != nil {
+				c.closeResponseBody(resp)
+			}
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			c.logger.Warn("node-red request failed",
+				"method", method,
+				"url", url,
+				"attempt", attempt+1,
+				"latency", latency,
+				"error", err,
+			)
+		} else {
+			c.logger.Debug("node-red response",
+				"method", method,
+				"url", url,
+				"attempt", attempt+1,
+				"status", resp.StatusCode,
+				"latency", latency,
+			)
+		}
+
+		if breaker != nil {
+			breaker.record(err == nil && (opts.execution || resp.StatusCode < http.StatusInternalServerError))
+		}
+
+		if opts.auth && !refreshed && err == nil && resp.StatusCode == http.StatusUnauthorized && c.tokens.canRefresh() {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			c.closeResponseBody(resp)
+
+			if token, err = c.refreshToken(ctx, token); err != nil {
+				return nil, err
+			}
+			refreshed = true
+			attempt--
+			continue
+		}
+
+		var transient, retryable bool
+		if err != nil {
+			transient = isRetryableError(err)
+			retryable = transient && (idempotent || isConnectError(err))
+		} else {
+			transient = isRetryableStatus(resp.StatusCode)
+			retryable = transient && (idempotent || resp.StatusCode == http.StatusTooManyRequests)
+		}
+
+		if !retryable || attempt >= opts.maxRetries {
+			if err != nil && transient {
+				err = fmt.Errorf("%w: %w", types.ErrUnavailable, err)
+			}
+			return resp, err
+		}
+
+		delay := c.retry.backoff(attempt + 1)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			c.closeResponseBody(resp)
+		}
+
+		c.logger.Warn("retrying node-red request",
+			"method", method,
+			"url", url,
+			"delay", delay,
+			"retry", attempt+1,
+			"max_retries", opts.maxRetries,
+		)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
 // DeployFlow deploys or updates a flow in Node-RED
 func (c *NodeRedClient) DeployFlow(ctx context.Context, flow *types.FlowDefinition) error {
+	// Wires may be given as Connections only
+	flow, err := flow.Reconciled()
+	if err != nil {
+		return fmt.Errorf("failed to deploy flow: %w", err)
+	}
+	if flow.ID == types.GlobalFlowID {
+		return c.deployGlobal(ctx, flow)
+	}
+
 	// Node-RED expects a flat array of nodes, not a FlowDefinition object
 	// Convert FlowDefinition to Node-RED format
-	nodeRedNodes := c.convertFlowToNodeRedFormat(flow)
+	nodeRedNodes := convertFlowToNodeRedFormat(flow)
 
 	// For /flow endpoint, send the tab node and its children as nodes array
 	payload := map[string]interface{}{
@@ -57,6 +307,26 @@ func (c *NodeRedClient) DeployFlow(ctx context.Context, flow *types.FlowDefiniti
 	if flow.Description != "" {
 		payload["info"] = flow.Description
 	}
+	if flow.Disabled {
+		payload["disabled"] = true
+	}
+	if len(flow.Env) > 0 {
+		setEnv(payload, flow.Env)
+	}
+	if len(flow.Configs) > 0 {
+		configs := make([]map[string]interface{}, 0, len(flow.Configs))
+		for _, node := range flow.Configs {
+			configs = append(configs, convertConfigToNodeRedFormat(node, flow.ID))
+		}
+		payload["configs"] = configs
+	}
+	if len(flow.Subflows) > 0 {
+		subflows := make([]map[string]interface{}, 0, len(flow.Subflows))
+		for _, subflow := range types.OrderSubflows(flow.Subflows) {
+			subflows = append(subflows, convertSubflowToNested(subflow))
+		}
+		payload["subflows"] = subflows
+	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
@@ -67,21 +337,9 @@ func (c *NodeRedClient) DeployFlow(ctx context.Context, flow *types.FlowDefiniti
 	url := fmt.Sprintf("%s/flow/%s", c.baseURL, flow.ID)
 	method := "PUT"
 
-	if c.debug {
-		fmt.Printf("Deploying flow to %s using %s: %s\n", url, method, string(jsonData))
-	}
-
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
+	c.logger.Debug("deploying flow", "flow_id", flow.ID, "nodes", len(flow.Nodes))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, method, url, jsonData)
 	if err != nil {
 		return fmt.Errorf("failed to deploy flow: %w", err)
 	}
@@ -89,62 +347,77 @@ func (c *NodeRedClient) DeployFlow(ctx context.Context, flow *types.FlowDefiniti
 
 	// If flow doesn't exist (404), try creating it with POST
 	if resp.StatusCode == http.StatusNotFound {
-		if c.debug {
-			fmt.Println("Flow not found, creating new flow with POST")
-		}
+		c.logger.Debug("flow not found, creating it", "flow_id", flow.ID)
 		return c.createFlow(ctx, jsonData)
 	}
 
 	// /flow endpoint returns 200 for success
 	if resp.StatusCode != http.StatusOK {
 		// Try to read error body
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to deploy flow: status %d, failed to read error body: %w", resp.StatusCode, err)
-		}
-		return fmt.Errorf("failed to deploy flow: status %d, body: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("failed to deploy flow: %w", newAPIError(resp, nil))
 	}
 
 	return nil
 }
 
-// createFlow creates a new flow using POST /flow
-func (c *NodeRedClient) createFlow(ctx context.Context, jsonData []byte) error {
-	url := fmt.Sprintf("%s/flow", c.baseURL)
+// deployGlobal replaces the global config nodes and subflows using
+// PUT /flow/global. The global flow always exists and has no tab or nodes.
+func (c *NodeRedClient) deployGlobal(ctx context.Context, flow *types.FlowDefinition) error {
+	if len(flow.Nodes) > 0 {
+		return fmt.Errorf("failed to deploy flow: the %s flow holds config nodes and subflows only, not nodes", types.GlobalFlowID)
+	}
 
-	if c.debug {
-		fmt.Printf("Creating new flow at %s: %s\n", url, string(jsonData))
+	configs := make([]map[string]interface{}, 0, len(flow.Configs))
+	for _, node := range flow.Configs {
+		configs = append(configs, convertConfigToNodeRedFormat(node, ""))
+	}
+	subflows := make([]map[string]interface{}, 0, len(flow.Subflows))
+	for _, subflow := range types.OrderSubflows(flow.Subflows) {
+		subflows = append(subflows, convertSubflowToNested(subflow))
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"id":       types.GlobalFlowID,
+		"configs":  configs,
+		"subflows": subflows,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to marshal flow: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	c.logger.Debug("deploying global config", "configs", len(configs), "subflows", len(subflows))
+
+	resp, err := c.do(ctx, "PUT", fmt.Sprintf("%s/flow/%s", c.baseURL, types.GlobalFlowID), jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to deploy flow: %w", err)
 	}
+	defer c.closeResponseBody(resp)
 
-	resp, err := c.httpClient.Do(req)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to deploy flow: %w", newAPIError(resp, nil))
+	}
+	return nil
+}
+
+// createFlow creates a new flow using POST /flow
+func (c *NodeRedClient) createFlow(ctx context.Context, jsonData []byte) error {
+	url := fmt.Sprintf("%s/flow", c.baseURL)
+
+	resp, err := c.do(ctx, "POST", url, jsonData)
 	if err != nil {
 		return fmt.Errorf("failed to create flow: %w", err)
 	}
 	defer c.closeResponseBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to create flow: status %d, failed to read error body: %w", resp.StatusCode, err)
-		}
-		return fmt.Errorf("failed to create flow: status %d, body: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("failed to create flow: %w", newAPIError(resp, nil))
 	}
 
 	return nil
 }
 
 // convertFlowToNodeRedFormat converts a FlowDefinition to Node-RED's expected format
-func (c *NodeRedClient) convertFlowToNodeRedFormat(flow *types.FlowDefinition) []map[string]interface{} {
+func convertFlowToNodeRedFormat(flow *types.FlowDefinition) []map[string]interface{} {
 	var nodeRedNodes []map[string]interface{}
 
 	// Add a tab (flow container) node
@@ -156,68 +429,22 @@ func (c *NodeRedClient) convertFlowToNodeRedFormat(flow *types.FlowDefinition) [
 	if flow.Description != "" {
 		tabNode["info"] = flow.Description
 	}
+	if flow.Disabled {
+		tabNode["disabled"] = true
+	}
+	if len(flow.Env) > 0 {
+		setEnv(tabNode, flow.Env)
+	}
 	nodeRedNodes = append(nodeRedNodes, tabNode)
 
 	// Convert each node
 	for _, node := range flow.Nodes {
-		nodeRedNode := map[string]interface{}{
-			"id":    node.ID,
-			"type":  node.Type,
-			"name":  node.Name,
-			"x":     node.Position.X,
-			"y":     node.Position.Y,
-			"z":     flow.ID, // Link node to the tab/flow
-			"wires": node.Wires,
-		}
-
-		// Add all properties from the node
-		for key, value := range node.Properties {
-			nodeRedNode[key] = value
-		}
-
-		nodeRedNodes = append(nodeRedNodes, nodeRedNode)
+		nodeRedNodes = append(nodeRedNodes, convertNodeToNodeRedFormat(node, flow.ID))
 	}
 
 	return nodeRedNodes
 }
 
-// ExecuteFlow triggers a flow execution
-func (c *NodeRedClient) ExecuteFlow(ctx context.Context, flowID string, input map[string]interface{}) (*types.ExecutionResult, error) {
-	url := fmt.Sprintf("%s/flows/%s/execute", c.baseURL, flowID)
-
-	jsonData, err := json.Marshal(input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal input: %w", err)
-	}
-
-	if c.debug {
-		fmt.Printf("Executing flow %s: %s\n", flowID, string(jsonData))
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute flow: %w", err)
-	}
-	defer c.closeResponseBody(resp)
-
-	var result types.ExecutionResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return &result, nil
-}
-
 // TriggerNode triggers a specific node (like an inject node) with input data
 func (c *NodeRedClient) TriggerNode(ctx context.Context, nodeID string, input map[string]interface{}) error {
 	url := fmt.Sprintf("%s/inject/%s", c.baseURL, nodeID)
@@ -227,32 +454,16 @@ func (c *NodeRedClient) TriggerNode(ctx context.Context, nodeID string, input ma
 		return fmt.Errorf("failed to marshal input: %w", err)
 	}
 
-	if c.debug {
-		fmt.Printf("Triggering node %s: %s\n", nodeID, string(jsonData))
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
+	c.logger.Debug("triggering node", "node_id", nodeID)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, "POST", url, jsonData)
 	if err != nil {
 		return fmt.Errorf("failed to trigger node: %w", err)
 	}
 	defer c.closeResponseBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to trigger node: status %d, failed to read error body: %w", resp.StatusCode, err)
-		}
-		return fmt.Errorf("failed to trigger node: status %d, body: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("failed to trigger node: %w", newAPIError(resp, nil))
 	}
 
 	return nil
@@ -262,93 +473,84 @@ func (c *NodeRedClient) TriggerNode(ctx context.Context, nodeID string, input ma
 func (c *NodeRedClient) GetFlow(ctx context.Context, flowID string) (*types.FlowDefinition, error) {
 	url := fmt.Sprintf("%s/flow/%s", c.baseURL, flowID)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get flow: %w", err)
 	}
 	defer c.closeResponseBody(resp)
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("flow not found: %s", flowID)
+		return nil, fmt.Errorf("failed to get flow %s: %w", flowID, newAPIError(resp, types.ErrFlowNotFound))
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get flow: status %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to get flow: %w", newAPIError(resp, nil))
 	}
 
-	var flow types.FlowDefinition
-	if err := json.NewDecoder(resp.Body).Decode(&flow); err != nil {
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
 		return nil, fmt.Errorf("failed to decode flow: %w", err)
 	}
 
-	return &flow, nil
-}
-
-// GetFlows retrieves all deployed flows from Node-RED
-func (c *NodeRedClient) GetFlows(ctx context.Context) ([]map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/flows", c.baseURL)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	flow, err := convertNodeRedToFlow(raw)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to decode flow: %w", err)
 	}
 
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
+	return flow, nil
+}
+
+// GetCredentials reads the credentials Node-RED holds for a node. Secret
+// fields come back as CredentialPlaceholder, other fields with their values;
+// a node without credentials yields nil.
+func (c *NodeRedClient) GetCredentials(ctx context.Context, nodeType, nodeID string) (types.Credentials, error) {
+	endpoint := fmt.Sprintf("%s/credentials/%s/%s", c.baseURL, url.PathEscape(nodeType), url.PathEscape(nodeID))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get flows: %w", err)
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
 	}
 	defer c.closeResponseBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get flows: status %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to get credentials: %w", newAPIError(resp, nil))
 	}
 
-	var flows []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&flows); err != nil {
-		return nil, fmt.Errorf("failed to decode flows response: %w", err)
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %w", err)
 	}
 
-	return flows, nil
+	return convertNodeRedCredentials(raw), nil
 }
 
-// DeleteFlow removes a flow from Node-RED
-func (c *NodeRedClient) DeleteFlow(ctx context.Context, flowID string) error {
-	url := fmt.Sprintf("%s/flows/%s", c.baseURL, flowID)
-
-	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+// GetFlows retrieves all deployed flows from Node-RED
+func (c *NodeRedClient) GetFlows(ctx context.Context) ([]map[string]interface{}, error) {
+	config, err := c.GetFlowConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
+	return config.Flows, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// DeleteFlow removes a flow from Node-RED
+func (c *NodeRedClient) DeleteFlow(ctx context.Context, flowID string) error {
+	url := fmt.Sprintf("%s/flow/%s", c.baseURL, flowID)
+
+	resp, err := c.do(ctx, "DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete flow: %w", err)
 	}
 	defer c.closeResponseBody(resp)
 
 	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("flow not found: %s", flowID)
+		return fmt.Errorf("failed to delete flow %s: %w", flowID, newAPIError(resp, types.ErrFlowNotFound))
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to delete flow: status %d", resp.StatusCode)
+	// Node-RED answers 204; 200 is accepted from proxies and older versions
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete flow: %w", newAPIError(resp, nil))
 	}
 
 	return nil
@@ -358,80 +560,15 @@ func (c *NodeRedClient) DeleteFlow(ctx context.Context, flowID string) error {
 func (c *NodeRedClient) HealthCheck(ctx context.Context) error {
 	url := fmt.Sprintf("%s/health", c.baseURL)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to check health: %w", err)
 	}
 	defer c.closeResponseBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Node-RED is not healthy: status %d", resp.StatusCode)
+		return fmt.Errorf("Node-RED is not healthy: %w", newAPIError(resp, nil))
 	}
 
 	return nil
 }
-
-// GetAuthToken authenticates with Node-RED and returns an access token
-func (c *NodeRedClient) GetAuthToken(ctx context.Context, username, password string) (string, error) {
-	url := fmt.Sprintf("%s/auth/token", c.baseURL)
-
-	// Prepare authentication request payload
-	authPayload := map[string]interface{}{
-		"client_id":  "node-red-admin",
-		"grant_type": "password",
-		"scope":      "*",
-		"username":   username,
-		"password":   password,
-	}
-
-	jsonData, err := json.Marshal(authPayload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal auth payload: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create auth request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to authenticate: %w", err)
-	}
-	defer c.closeResponseBody(resp)
-
-	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "", fmt.Errorf("authentication failed: status %d, failed to read error body: %w", resp.StatusCode, err)
-		}
-		return "", fmt.Errorf("authentication failed: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse the response to extract the access token
-	var authResponse struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
-		ExpiresIn   int    `json:"expires_in"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
-		return "", fmt.Errorf("failed to decode auth response: %w", err)
-	}
-
-	if authResponse.AccessToken == "" {
-		return "", fmt.Errorf("no access token in auth response")
-	}
-
-	// Update the client's API key
-	c.apiKey = authResponse.AccessToken
-
-	return authResponse.AccessToken, nil
-}
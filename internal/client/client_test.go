@@ -0,0 +1,921 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+func newTestClient(t *testing.T, url string, retries int) *NodeRedClient {
+	t.Helper()
+
+	c, err := NewNodeRedClient(&types.Config{
+		NodeRedURL:    url,
+		Timeout:       5 * time.Second,
+		RetryAttempts: retries,
+		RetryPolicy: &types.RetryPolicy{
+			InitialDelay:  time.Millisecond,
+			MaxDelay:      5 * time.Millisecond,
+			BackoffFactor: 2,
+		},
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestNodeRedClient_Retry(t *testing.T) {
+	t.Run("retries transient statuses until success", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		defer server.Close()
+
+		c := newTestClient(t, server.URL, 3)
+		flows, err := c.GetFlows(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, flows)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		c := newTestClient(t, server.URL, 3)
+		_, err := c.GetFlows(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		c := newTestClient(t, server.URL, 2)
+		err := c.HealthCheck(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("resends request body on every attempt", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"message":"hi"}`, string(body))
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		c := newTestClient(t, server.URL, 1)
+		err := c.TriggerNode(context.Background(), "inject-1", map[string]interface{}{"message": "hi"})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("does not resend POSTs Node-RED may have acted on", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if r.URL.Path == "/inject/reset" {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				_ = conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		c := newTestClient(t, server.URL, 3)
+		err := c.TriggerNode(context.Background(), "failing", nil)
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		err = c.TriggerNode(context.Background(), "reset", nil)
+		assert.ErrorIs(t, err, types.ErrUnavailable)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("honors context cancellation between attempts", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		c := newTestClient(t, server.URL, 5)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := c.HealthCheck(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := newRetryPolicy(&types.Config{
+		RetryAttempts: 4,
+		RetryPolicy: &types.RetryPolicy{
+			InitialDelay:  100 * time.Millisecond,
+			MaxDelay:      time.Second,
+			BackoffFactor: 2,
+		},
+	})
+	assert.Equal(t, 4, policy.maxRetries)
+
+	for attempt, ceiling := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		6: time.Second,
+	} {
+		delay := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, ceiling/2)
+		assert.LessOrEqual(t, delay, ceiling)
+	}
+
+	// Only failures to connect are safe to retry for any request
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	_, err := http.Post(server.URL, "application/json", nil)
+	require.Error(t, err)
+	assert.True(t, isRetryableError(err))
+	assert.True(t, isConnectError(err))
+	assert.False(t, isConnectError(io.ErrUnexpectedEOF))
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	after, ok := retryAfter(resp)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, after)
+}
+
+func TestNodeRedClient_CircuitBreaker(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, err := NewNodeRedClient(&types.Config{
+		NodeRedURL: server.URL,
+		Timeout:    5 * time.Second,
+		CircuitBreaker: &types.CircuitBreaker{
+			MaxFailures: 2,
+			Timeout:     20 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+
+	var changes []types.CircuitStateChange
+	c.OnCircuitStateChange(func(change types.CircuitStateChange) {
+		changes = append(changes, change)
+	})
+
+	ctx := context.Background()
+	assert.Error(t, c.HealthCheck(ctx))
+	assert.Error(t, c.HealthCheck(ctx))
+
+	// The breaker is now open and rejects calls without reaching the server
+	err = c.HealthCheck(ctx)
+	assert.ErrorIs(t, err, types.ErrCircuitOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, types.CircuitOpen, c.CircuitStates()["*"])
+
+	// After the timeout a successful probe closes it again
+	healthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, c.HealthCheck(ctx))
+	assert.Equal(t, types.CircuitClosed, c.CircuitStates()["*"])
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, types.CircuitOpen, changes[0].To)
+	assert.Equal(t, types.CircuitHalfOpen, changes[1].To)
+	assert.Equal(t, types.CircuitClosed, changes[2].To)
+}
+
+func TestNodeRedClient_ExecuteFlow(t *testing.T) {
+	var logins, executions int32
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/token":
+			atomic.AddInt32(&logins, 1)
+			_, _ = w.Write([]byte(`{"access_token":"admin","token_type":"Bearer","expires_in":3600}`))
+		case ExecutionPath("flow-1"):
+			atomic.AddInt32(&executions, 1)
+			assert.Empty(t, r.Header.Get("Authorization"), "the admin token is not sent to http in routes")
+			w.WriteHeader(int(status.Load()))
+			_, _ = w.Write([]byte(`{"error":"flow failed"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewNodeRedClient(&types.Config{
+		NodeRedURL:     server.URL,
+		Timeout:        5 * time.Second,
+		CircuitBreaker: &types.CircuitBreaker{MaxFailures: 1, Timeout: time.Minute},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = c.GetAuthToken(ctx, "admin", "secret")
+	require.NoError(t, err)
+
+	// Failing flows do not open the circuit breaker
+	status.Store(http.StatusInternalServerError)
+	for i := 0; i < 3; i++ {
+		result, err := c.ExecuteFlow(ctx, "flow-1", nil)
+		require.NoError(t, err)
+		assert.False(t, result.Success)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&executions))
+	assert.Equal(t, types.CircuitClosed, c.CircuitStates()["*"])
+
+	// A 401 from an http in route is the flow's answer, not an expired token
+	status.Store(http.StatusUnauthorized)
+	result, err := c.ExecuteFlow(ctx, "flow-1", nil)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+}
+
+func TestNodeRedClient_ExecutionTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	c, err := NewNodeRedClient(&types.Config{
+		NodeRedURL: server.URL,
+		Timeout:    20 * time.Millisecond,
+		Execution:  &types.ExecutionOptions{Timeout: 5 * time.Second},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Executions may outlast the admin API timeout
+	result, err := c.ExecuteFlow(ctx, "slow", nil)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Error(t, c.HealthCheck(ctx))
+}
+
+func TestEndpointKey(t *testing.T) {
+	base := "http://localhost:1880/admin"
+	assert.Equal(t, "PUT /flow", endpointKey("PUT", base+"/flow/abc", base))
+	assert.Equal(t, "GET /flows", endpointKey("GET", base+"/flows", base))
+	assert.Equal(t, "POST /inject", endpointKey("POST", base+"/inject/n1?x=1", base))
+}
+
+// fakeNodeRed stores flows written through PUT/POST /flow and serves them back
+// on GET /flow/:id the way Node-RED does
+func fakeNodeRed(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	flows := map[string]json.RawMessage{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := strings.TrimPrefix(r.URL.Path, "/flow/")
+		switch {
+		case r.Method == http.MethodGet:
+			data, ok := flows[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		case r.Method == http.MethodPut && flows[id] == nil:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			var payload struct {
+				ID string `json:"id"`
+			}
+			require.NoError(t, json.Unmarshal(body, &payload))
+			flows[payload.ID] = body
+			_, _ = w.Write([]byte(`{"id":"` + payload.ID + `"}`))
+		}
+	}))
+}
+
+func TestNodeRedClient_GetFlowRoundTrip(t *testing.T) {
+	server := fakeNodeRed(t)
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	flow := &types.FlowDefinition{
+		ID:          "flow-1",
+		Name:        "Round Trip",
+		Description: "Checks that flows survive a deploy and read",
+		Env: []types.EnvVar{
+			{Name: "GREETING", Value: "hello", Type: "str"},
+		},
+		Nodes: []types.Node{
+			{
+				ID:       "inject-1",
+				Type:     "inject",
+				Name:     "Start",
+				Position: types.Position{X: 100, Y: 80},
+				Wires:    [][]string{{"function-1"}},
+				Properties: map[string]interface{}{
+					"payload":     "",
+					"payloadType": "date",
+					"repeat":      "",
+				},
+			},
+			{
+				ID:       "function-1",
+				Type:     "function",
+				Position: types.Position{X: 300, Y: 80},
+				Wires:    [][]string{{"debug-1"}, {}},
+				Properties: map[string]interface{}{
+					"func":    "return msg;",
+					"outputs": float64(2),
+				},
+			},
+			{
+				ID:       "debug-1",
+				Type:     "debug",
+				Name:     "Log",
+				Position: types.Position{X: 500, Y: 80},
+				Wires:    [][]string{},
+				Properties: map[string]interface{}{
+					"active":   true,
+					"complete": "payload",
+				},
+			},
+		},
+		Configs: []types.Node{
+			{
+				ID:    "broker-1",
+				Type:  "mqtt-broker",
+				Name:  "Local",
+				Wires: [][]string{},
+				Properties: map[string]interface{}{
+					"broker": "localhost",
+					"port":   "1883",
+				},
+			},
+		},
+		Connections: []types.Connection{
+			{Source: "inject-1", Target: "function-1"},
+			{Source: "function-1", Target: "debug-1"},
+		},
+		Subflows: []types.SubflowDefinition{{
+			ID:   "sf-1",
+			Name: "Shared",
+			In:   []types.SubflowPort{{Position: types.Position{X: 40, Y: 40}, Wires: []types.SubflowWire{{ID: "sf-n1"}}}},
+			Out:  []types.SubflowPort{},
+			Env:  []types.EnvVar{{Name: "LEVEL", Value: "1", Type: "num"}},
+			Nodes: []types.Node{
+				{ID: "sf-n1", Type: "function", Position: types.Position{X: 140, Y: 40}, Wires: [][]string{{}}, Properties: map[string]interface{}{"func": "return msg;"}},
+			},
+			Properties: map[string]interface{}{"color": "#DDAA99"},
+		}},
+	}
+
+	ctx := context.Background()
+	require.NoError(t, c.DeployFlow(ctx, flow))
+
+	got, err := c.GetFlow(ctx, flow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, flow, got)
+}
+
+// flowResponse is a GET /flow/:id response in the shape Node-RED's admin API
+// returns it: node properties flattened, nodes and tab-scoped config nodes
+// placed on the tab with z, subflows nested with their members. It is written
+// by hand, not recorded from a running instance.
+const flowResponse = `{
+    "id": "flow-1",
+    "label": "Orders",
+    "disabled": false,
+    "info": "",
+    "env": [{"name": "TENANT", "value": "acme", "type": "str"}],
+    "nodes": [
+        {"id": "in-1", "type": "mqtt in", "z": "flow-1", "name": "Orders", "topic": "orders", "qos": "2", "broker": "broker-1", "x": 120, "y": 60, "wires": [["sf-inst"]]},
+        {"id": "sf-inst", "type": "subflow:sf-1", "z": "flow-1", "name": "", "env": [], "x": 300, "y": 60, "wires": [[]]}
+    ],
+    "configs": [
+        {"id": "broker-1", "type": "mqtt-broker", "z": "flow-1", "name": "Local", "broker": "localhost", "port": "1883"}
+    ],
+    "subflows": [
+        {"id": "sf-1", "type": "subflow", "name": "Clean", "info": "", "category": "", "in": [{"x": 40, "y": 40, "wires": [{"id": "sf-n1"}]}], "out": [{"x": 240, "y": 40, "wires": [{"id": "sf-n1", "port": 0}]}], "color": "#DDAA99", "nodes": [
+            {"id": "sf-n1", "type": "function", "z": "sf-1", "name": "", "func": "return msg;", "outputs": 1, "x": 140, "y": 40, "wires": [[]]}
+        ]}
+    ]
+}`
+
+func TestNodeRedClient_GetFlowResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(flowResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	got, err := c.GetFlow(context.Background(), "flow-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, &types.FlowDefinition{
+		ID:   "flow-1",
+		Name: "Orders",
+		Env:  []types.EnvVar{{Name: "TENANT", Value: "acme", Type: types.EnvString}},
+		Nodes: []types.Node{
+			{
+				ID: "in-1", Type: "mqtt in", Name: "Orders",
+				Position:   types.Position{X: 120, Y: 60},
+				Properties: map[string]interface{}{"topic": "orders", "qos": "2", "broker": "broker-1"},
+				Wires:      [][]string{{"sf-inst"}},
+			},
+			{
+				ID: "sf-inst", Type: "subflow:sf-1",
+				Position:   types.Position{X: 300, Y: 60},
+				Properties: map[string]interface{}{"env": []interface{}{}},
+				Wires:      [][]string{{}},
+			},
+		},
+		Configs: []types.Node{{
+			ID: "broker-1", Type: "mqtt-broker", Name: "Local",
+			Properties: map[string]interface{}{"broker": "localhost", "port": "1883"},
+			Wires:      [][]string{},
+		}},
+		Subflows: []types.SubflowDefinition{{
+			ID:   "sf-1",
+			Name: "Clean",
+			In:   []types.SubflowPort{{Position: types.Position{X: 40, Y: 40}, Wires: []types.SubflowWire{{ID: "sf-n1"}}}},
+			Out:  []types.SubflowPort{{Position: types.Position{X: 240, Y: 40}, Wires: []types.SubflowWire{{ID: "sf-n1"}}}},
+			Nodes: []types.Node{{
+				ID: "sf-n1", Type: "function",
+				Position:   types.Position{X: 140, Y: 40},
+				Properties: map[string]interface{}{"func": "return msg;", "outputs": float64(1)},
+				Wires:      [][]string{{}},
+			}},
+			Properties: map[string]interface{}{"color": "#DDAA99"},
+		}},
+		Connections: []types.Connection{{Source: "in-1", Target: "sf-inst"}},
+	}, got)
+}
+
+func TestNodeRedClient_DeployConnections(t *testing.T) {
+	server := fakeNodeRed(t)
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	ctx := context.Background()
+
+	flow := &types.FlowDefinition{
+		ID: "flow-1",
+		Nodes: []types.Node{
+			{ID: "in", Type: "inject"},
+			{ID: "sw", Type: "switch", Wires: [][]string{{}, {}}},
+			{ID: "a", Type: "debug"},
+			{ID: "b", Type: "debug"},
+		},
+		Connections: []types.Connection{
+			{Source: "in", Target: "sw"},
+			{Source: "sw", Target: "a"},
+			{Source: "sw", Target: "b", SourcePort: 1},
+		},
+	}
+	require.NoError(t, c.DeployFlow(ctx, flow))
+	assert.Nil(t, flow.Nodes[0].Wires, "the caller's flow is not modified")
+
+	got, err := c.GetFlow(ctx, flow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"sw"}}, got.Nodes[0].Wires)
+	assert.Equal(t, [][]string{{"a"}, {"b"}}, got.Nodes[1].Wires)
+	assert.Equal(t, flow.Connections, got.Connections)
+
+	// Wires and connections that disagree are not deployed
+	flow.Nodes[0].Wires = [][]string{{"a"}}
+	err = c.DeployFlow(ctx, flow)
+	assert.ErrorIs(t, err, types.ErrConnectionConflict)
+	var conflict *types.ConnectionConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "in", conflict.Conflicts[0].NodeID)
+
+	// Matching wires and connections are accepted
+	flow.Nodes[0].Wires = [][]string{{"sw"}}
+	require.NoError(t, c.DeployFlow(ctx, flow))
+
+	// Wires the connections leave out are a conflict too
+	flow.Nodes[2].Wires = [][]string{{"b"}}
+	err = c.DeployFlow(ctx, flow)
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "a", conflict.Conflicts[0].NodeID)
+}
+
+func TestConvertNodeRedToNode(t *testing.T) {
+	node, err := convertNodeRedToNode(map[string]interface{}{
+		"id":          "n1",
+		"type":        "change",
+		"z":           "tab-1",
+		"x":           float64(120),
+		"y":           "40",
+		"rules":       []interface{}{map[string]interface{}{"t": "set"}},
+		"wires":       []interface{}{[]interface{}{"n2", "n3"}},
+		"d":           true,
+		"reg":         false,
+		"action":      "",
+		"property":    "",
+		"from":        "",
+		"to":          "",
+		"__unknown__": "kept",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "n1", node.ID)
+	assert.Equal(t, types.Position{X: 120, Y: 40}, node.Position)
+	assert.Equal(t, [][]string{{"n2", "n3"}}, node.Wires)
+	assert.Equal(t, "kept", node.Properties["__unknown__"])
+	assert.Equal(t, true, node.Properties["d"])
+	assert.NotContains(t, node.Properties, "z")
+	assert.NotContains(t, node.Properties, "x")
+
+	_, err = convertNodeRedToNode(map[string]interface{}{"id": "bad", "wires": "nope"})
+	assert.Error(t, err)
+}
+
+func TestNodeRedClient_Credentials(t *testing.T) {
+	var deployed map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/flow/flow-1":
+			deployed = nil
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&deployed))
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/credentials/mqtt-broker/broker-1":
+			// Node-RED returns text fields and marks the secret ones
+			_, _ = w.Write([]byte(`{"user":"svc","has_password":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	ctx := context.Background()
+
+	flow := &types.FlowDefinition{
+		ID: "flow-1",
+		Env: []types.EnvVar{
+			{Name: "TENANT", Value: "acme", Type: types.EnvString},
+			{Name: "API_TOKEN", Value: "token", Type: types.EnvCredential},
+		},
+		Nodes: []types.Node{{ID: "in", Type: "mqtt in", Properties: map[string]interface{}{"broker": "broker-1"}}},
+		Configs: []types.Node{{
+			ID:          "broker-1",
+			Type:        "mqtt-broker",
+			Credentials: types.Credentials{"user": "svc", "password": "secret"},
+		}},
+	}
+	require.NoError(t, c.DeployFlow(ctx, flow))
+
+	configs := deployed["configs"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"user": "svc", "password": "secret"},
+		configs[0].(map[string]interface{})["credentials"])
+	// Nodes without credentials keep the ones Node-RED holds
+	nodes := deployed["nodes"].([]interface{})
+	assert.NotContains(t, nodes[0].(map[string]interface{}), "credentials")
+
+	// Values of cred env vars go with the tab's credentials
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "TENANT", "value": "acme", "type": "str"},
+		map[string]interface{}{"name": "API_TOKEN", "type": "cred"},
+	}, deployed["env"])
+	assert.Equal(t, map[string]interface{}{"API_TOKEN": "token"}, deployed["credentials"])
+
+	// and are kept by Node-RED when not given
+	flow.Env[1].Value = ""
+	require.NoError(t, c.DeployFlow(ctx, flow))
+	assert.NotContains(t, deployed, "credentials")
+
+	// Reading a flows file restores them
+	flows, err := GroupFlows(
+		[]map[string]interface{}{{"id": "flow-1", "type": "tab", "env": deployed["env"]}},
+		map[string]map[string]interface{}{"flow-1": {"API_TOKEN": "token"}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, types.EnvVar{Name: "API_TOKEN", Value: "token", Type: types.EnvCredential}, flows[0].Env[1])
+
+	credentials, err := c.GetCredentials(ctx, "mqtt-broker", "broker-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.Credentials{"user": "svc", "password": types.CredentialPlaceholder}, credentials)
+
+	// Values never show when printed or marshalled
+	encoded, err := json.Marshal(flow)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "secret")
+	assert.Contains(t, string(encoded), `"password":"[REDACTED]"`)
+	printed := fmt.Sprintf("%v %+v %#v", flow.Configs[0], flow.Configs[0], flow.Configs[0])
+	assert.NotContains(t, printed, "secret")
+	assert.Contains(t, printed, "credentials[password user]")
+	flow.Env[1].Value = "token"
+	encoded, err = json.Marshal(flow.Env)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "token")
+	assert.NotContains(t, fmt.Sprintf("%v %#v", flow.Env, flow.Env), "token")
+}
+
+func TestNodeRedClient_DeployAllRevision(t *testing.T) {
+	rev := "rev-1"
+	var deployed []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "v2", r.Header.Get("Node-RED-API-Version"))
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"rev":   rev,
+				"flows": []interface{}{map[string]interface{}{"id": "tab-1", "type": "tab"}},
+			})
+		case http.MethodPost:
+			var body struct {
+				Rev   string        `json:"rev"`
+				Flows []interface{} `json:"flows"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			if body.Rev != "" && body.Rev != rev {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"code":"version_mismatch"}`))
+				return
+			}
+			deployed = body.Flows
+			rev = "rev-2"
+			_ = json.NewEncoder(w).Encode(map[string]string{"rev": rev})
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	ctx := context.Background()
+
+	config, err := c.GetFlowConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "rev-1", config.Rev)
+	assert.Len(t, config.Flows, 1)
+
+	flows := []*types.FlowDefinition{{
+		ID:    "tab-1",
+		Name:  "Tab",
+		Nodes: []types.Node{{ID: "n1", Type: "debug"}},
+		Subflows: []types.SubflowDefinition{{
+			ID:    "sf-1",
+			Nodes: []types.Node{{ID: "sf-n1", Type: "function"}},
+		}},
+	}}
+
+	newRev, err := c.DeployAll(ctx, flows, config.Rev, "")
+	require.NoError(t, err)
+	assert.Equal(t, "rev-2", newRev)
+	require.Len(t, deployed, 4)
+	// Subflow templates are deployed before the tabs using them
+	assert.Equal(t, "sf-1", deployed[0].(map[string]interface{})["id"])
+	assert.NotContains(t, deployed[0], "nodes")
+	assert.Equal(t, "sf-1", deployed[1].(map[string]interface{})["z"])
+	assert.Equal(t, "tab-1", deployed[2].(map[string]interface{})["id"])
+
+	// Deploying against the now stale revision is rejected
+	_, err = c.DeployAll(ctx, flows, config.Rev, "")
+	assert.ErrorIs(t, err, types.ErrConflict)
+}
+
+func TestNodeRedClient_DeploymentType(t *testing.T) {
+	var gotType string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Node-RED-Deployment-Type")
+		gotBody = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+		_ = json.NewEncoder(w).Encode(map[string]string{"rev": "rev-" + gotType})
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	ctx := context.Background()
+	flows := []*types.FlowDefinition{{ID: "tab-1", Nodes: []types.Node{{ID: "n1", Type: "debug"}}}}
+
+	rev, err := c.DeployAll(ctx, flows, "", types.DeployNodes)
+	require.NoError(t, err)
+	assert.Equal(t, "nodes", gotType)
+	assert.Equal(t, "rev-nodes", rev)
+	assert.Len(t, gotBody["flows"], 2)
+
+	_, err = c.DeployAll(ctx, flows, "", "")
+	require.NoError(t, err)
+	assert.Empty(t, gotType)
+
+	rev, err = c.ReloadFlows(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "reload", gotType)
+	assert.Equal(t, "rev-reload", rev)
+
+	_, err = c.DeployAll(ctx, flows, "", types.DeployReload)
+	assert.Error(t, err)
+	_, err = c.DeployAll(ctx, flows, "", "partial")
+	assert.Error(t, err)
+}
+
+func TestNodeRedClient_TokenLifecycle(t *testing.T) {
+	var mu sync.Mutex
+	var logins, revokes int
+	valid := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/auth/token":
+			logins++
+			token := "token-" + string(rune('0'+logins))
+			valid[token] = true
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": token,
+				"token_type":   "Bearer",
+				"expires_in":   604800,
+			})
+		case "/auth/revoke":
+			revokes++
+			delete(valid, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		default:
+			if !valid[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	ctx := context.Background()
+
+	start := time.Now()
+	token, err := c.GetAuthToken(ctx, "admin", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.WithinDuration(t, start.Add(7*24*time.Hour), c.Token().ExpiresAt, time.Minute)
+
+	// Concurrent requests rejected with 401 re-authenticate only once
+	mu.Lock()
+	valid = map[string]bool{}
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetFlows(ctx)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, logins)
+	assert.Equal(t, "token-2", c.Token().AccessToken)
+
+	// Tokens about to expire are renewed before the request is sent
+	c.tokens.now = func() time.Time { return start.Add(7*24*time.Hour - 30*time.Second) }
+	_, err = c.GetFlows(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, logins)
+	c.tokens.now = time.Now
+
+	require.NoError(t, c.Logout(ctx))
+	assert.Equal(t, 1, revokes)
+	assert.Empty(t, c.Token().AccessToken)
+
+	// Without credentials a 401 is returned to the caller
+	_, err = c.GetFlows(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 3, logins)
+}
+
+func TestNodeRedClient_TypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flow/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not_found","message":"Not found"}`))
+		case "/flow/secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/flows":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("restarting"))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, 0)
+	ctx := context.Background()
+
+	_, err := c.GetFlow(ctx, "missing")
+	assert.ErrorIs(t, err, types.ErrFlowNotFound)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	var apiErr *types.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "GET", apiErr.Method)
+	assert.Equal(t, server.URL+"/flow/missing", apiErr.URL)
+	assert.Equal(t, "not_found", apiErr.Code)
+	assert.Equal(t, "Not found", apiErr.Message)
+
+	_, err = c.GetFlow(ctx, "secret")
+	assert.ErrorIs(t, err, types.ErrUnauthorized)
+	assert.NotErrorIs(t, err, types.ErrFlowNotFound)
+
+	_, err = c.GetFlows(ctx)
+	assert.ErrorIs(t, err, types.ErrForbidden)
+
+	err = c.HealthCheck(ctx)
+	assert.ErrorIs(t, err, types.ErrUnavailable)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "restarting", apiErr.Body)
+
+	// Connection failures are reported as unavailable too
+	server.Close()
+	err = c.HealthCheck(ctx)
+	assert.ErrorIs(t, err, types.ErrUnavailable)
+}
+
+func TestNodeRedClient_Logging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"abc","expires_in":60}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	c, err := NewNodeRedClient(&types.Config{
+		NodeRedURL: server.URL,
+		Timeout:    5 * time.Second,
+		Logger:     newSlogLogger(&buf, "json", slog.LevelDebug),
+	})
+	require.NoError(t, err)
+
+	_, err = c.GetAuthToken(context.Background(), "admin", "hunter2")
+	require.NoError(t, err)
+
+	logged := buf.String()
+	assert.Contains(t, logged, `"msg":"node-red request"`)
+	assert.Contains(t, logged, `"msg":"node-red response"`)
+	assert.Contains(t, logged, `"latency"`)
+	assert.Contains(t, logged, `\"username\":\"admin\"`)
+	assert.NotContains(t, logged, "hunter2")
+}
+
+func TestRedactBody(t *testing.T) {
+	body := []byte(`{"nodes":[{"id":"n1","type":"yoyo-debug","apiKey":"k","Access_Token":"t","nested":{"client-secret":"s"}}]}`)
+	assert.JSONEq(t,
+		`{"nodes":[{"id":"n1","type":"yoyo-debug","apiKey":"[REDACTED]","Access_Token":"[REDACTED]","nested":{"client-secret":"[REDACTED]"}}]}`,
+		redactBody(body))
+	assert.Equal(t, "<9 bytes>", redactBody([]byte("password=")))
+	assert.Empty(t, redactBody(nil))
+}
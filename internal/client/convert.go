@@ -0,0 +1,593 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// nodeFields are the node keys mapped onto types.Node fields; every other key
+// of a Node-RED node is carried in Node.Properties
+var nodeFields = map[string]bool{
+	"id":          true,
+	"type":        true,
+	"name":        true,
+	"x":           true,
+	"y":           true,
+	"z":           true,
+	"wires":       true,
+	"credentials": true,
+}
+
+// convertNodeToNodeRedFormat flattens a Node into Node-RED's node format,
+// placing it on the tab identified by z
+func convertNodeToNodeRedFormat(node types.Node, z string) map[string]interface{} {
+	wires := node.Wires
+	if wires == nil {
+		wires = [][]string{}
+	}
+
+	nodeRedNode := map[string]interface{}{
+		"id":    node.ID,
+		"type":  node.Type,
+		"name":  node.Name,
+		"x":     node.Position.X,
+		"y":     node.Position.Y,
+		"z":     z, // Link node to the tab/flow
+		"wires": wires,
+	}
+
+	// Add all properties from the node
+	for key, value := range node.Properties {
+		nodeRedNode[key] = value
+	}
+
+	// A plain map, since Credentials redacts its values when marshalled
+	if len(node.Credentials) > 0 {
+		nodeRedNode["credentials"] = map[string]string(node.Credentials)
+	}
+
+	// Subflow instances built with types.SubflowDefinition.Instance
+	if env, ok := node.Properties["env"].([]types.EnvVar); ok {
+		setEnv(nodeRedNode, env)
+	}
+
+	return nodeRedNode
+}
+
+// setEnv sets the env of a tab, subflow template or subflow instance. Values
+// of cred variables are left out of the env and added to the credentials of
+// the node, which is where Node-RED keeps them.
+func setEnv(target map[string]interface{}, env []types.EnvVar) {
+	entries := make([]map[string]interface{}, 0, len(env))
+	for _, v := range env {
+		entry := map[string]interface{}{"name": v.Name, "type": v.Type}
+		entries = append(entries, entry)
+		if v.Type != types.EnvCredential {
+			entry["value"] = v.Value
+			continue
+		}
+		if v.Value == "" {
+			// Sending nothing keeps the stored value; "" would clear it
+			continue
+		}
+
+		credentials := make(map[string]string)
+		if existing, ok := target["credentials"].(map[string]string); ok {
+			for field, value := range existing {
+				credentials[field] = value
+			}
+		}
+		credentials[v.Name] = v.Value
+		target["credentials"] = credentials
+	}
+	target["env"] = entries
+}
+
+// readEnv is the inverse of setEnv. Node-RED returns no credentials, so cred
+// variables only get their values back when reading a flows file.
+func readEnv(raw map[string]interface{}, env *[]types.EnvVar) error {
+	if raw["env"] == nil {
+		return nil
+	}
+	if err := remarshal(raw["env"], env); err != nil {
+		return err
+	}
+	credentials, _ := raw["credentials"].(map[string]interface{})
+	for i, v := range *env {
+		if value, ok := credentials[v.Name].(string); ok && v.Type == types.EnvCredential {
+			(*env)[i].Value = value
+		}
+	}
+	return nil
+}
+
+// convertConfigToNodeRedFormat flattens a config node. Config nodes are not
+// drawn on the canvas, so they have no position or wires, and global config
+// nodes (empty z) have no z at all.
+func convertConfigToNodeRedFormat(node types.Node, z string) map[string]interface{} {
+	config := convertNodeToNodeRedFormat(node, z)
+	delete(config, "x")
+	delete(config, "y")
+	delete(config, "wires")
+	if z == "" {
+		delete(config, "z")
+	}
+	return config
+}
+
+// convertNodeRedToNode is the inverse of convertNodeToNodeRedFormat: known
+// fields populate the Node and everything else lands in Properties
+func convertNodeRedToNode(raw map[string]interface{}) (types.Node, error) {
+	node := types.Node{
+		Wires: [][]string{},
+	}
+
+	node.ID, _ = raw["id"].(string)
+	node.Type, _ = raw["type"].(string)
+	node.Name, _ = raw["name"].(string)
+	node.Position.X = toFloat(raw["x"])
+	node.Position.Y = toFloat(raw["y"])
+
+	if wires, ok := raw["wires"]; ok && wires != nil {
+		parsed, err := parseWires(wires)
+		if err != nil {
+			return node, fmt.Errorf("node %s: %w", node.ID, err)
+		}
+		node.Wires = parsed
+	}
+
+	if credentials, ok := raw["credentials"].(map[string]interface{}); ok {
+		node.Credentials = convertNodeRedCredentials(credentials)
+	}
+
+	for key, value := range raw {
+		if nodeFields[key] {
+			continue
+		}
+		if node.Properties == nil {
+			node.Properties = make(map[string]interface{})
+		}
+		node.Properties[key] = value
+	}
+
+	return node, nil
+}
+
+// convertNodeRedCredentials reads a node's credentials. Node-RED reports the
+// secrets it holds as has_<field> marks, which become placeholders that keep
+// the stored values when the node is deployed again.
+func convertNodeRedCredentials(raw map[string]interface{}) types.Credentials {
+	credentials := make(types.Credentials, len(raw))
+	for key, value := range raw {
+		if field, ok := strings.CutPrefix(key, "has_"); ok {
+			if set, _ := value.(bool); set && credentials[field] == "" {
+				credentials[field] = types.CredentialPlaceholder
+			}
+			continue
+		}
+		if s, ok := value.(string); ok {
+			credentials[key] = s
+		} else if value != nil {
+			credentials[key] = fmt.Sprint(value)
+		}
+	}
+	if len(credentials) == 0 {
+		return nil
+	}
+	return credentials
+}
+
+// convertNodeRedToFlow maps a Node-RED /flow/:id response onto a FlowDefinition
+func convertNodeRedToFlow(raw map[string]interface{}) (*types.FlowDefinition, error) {
+	flow := &types.FlowDefinition{
+		Nodes: []types.Node{},
+	}
+
+	flow.ID, _ = raw["id"].(string)
+	flow.Name, _ = raw["label"].(string)
+	flow.Description, _ = raw["info"].(string)
+	flow.Disabled, _ = raw["disabled"].(bool)
+
+	if err := readEnv(raw, &flow.Env); err != nil {
+		return nil, fmt.Errorf("invalid env: %w", err)
+	}
+
+	nodes, err := convertNodeRedNodes(raw["nodes"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid nodes: %w", err)
+	}
+	if nodes != nil {
+		flow.Nodes = nodes
+	}
+	flow.Connections = types.ConnectionsFromWires(flow.Nodes)
+
+	if flow.Configs, err = convertNodeRedNodes(raw["configs"]); err != nil {
+		return nil, fmt.Errorf("invalid configs: %w", err)
+	}
+
+	if subflows, ok := raw["subflows"].([]interface{}); ok && len(subflows) > 0 {
+		for _, item := range subflows {
+			template, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid subflow: %v", item)
+			}
+			subflow, err := convertNodeRedToSubflow(template)
+			if err != nil {
+				return nil, err
+			}
+			flow.Subflows = append(flow.Subflows, subflow)
+		}
+	}
+
+	return flow, nil
+}
+
+// subflowFields are the template keys mapped onto SubflowDefinition fields;
+// every other key is carried in SubflowDefinition.Properties
+var subflowFields = map[string]bool{
+	"id":          true,
+	"type":        true,
+	"name":        true,
+	"info":        true,
+	"category":    true,
+	"in":          true,
+	"out":         true,
+	"env":         true,
+	"nodes":       true,
+	"configs":     true,
+	"credentials": true,
+}
+
+// nodeRedPort is a subflow input or output as Node-RED stores it
+type nodeRedPort struct {
+	X     float64             `json:"x"`
+	Y     float64             `json:"y"`
+	Wires []types.SubflowWire `json:"wires"`
+}
+
+// convertSubflowTemplate flattens a subflow into its template node, without
+// the nodes it contains
+func convertSubflowTemplate(subflow types.SubflowDefinition) map[string]interface{} {
+	template := map[string]interface{}{
+		"id":   subflow.ID,
+		"type": "subflow",
+		"name": subflow.Name,
+		"info": subflow.Info,
+		"in":   convertPorts(subflow.In),
+		"out":  convertPorts(subflow.Out),
+	}
+	if subflow.Category != "" {
+		template["category"] = subflow.Category
+	}
+	if len(subflow.Env) > 0 {
+		setEnv(template, subflow.Env)
+	}
+	for key, value := range subflow.Properties {
+		template[key] = value
+	}
+	return template
+}
+
+// convertPorts converts subflow ports into Node-RED's format
+func convertPorts(ports []types.SubflowPort) []nodeRedPort {
+	converted := make([]nodeRedPort, 0, len(ports))
+	for _, port := range ports {
+		wires := port.Wires
+		if wires == nil {
+			wires = []types.SubflowWire{}
+		}
+		converted = append(converted, nodeRedPort{X: port.Position.X, Y: port.Position.Y, Wires: wires})
+	}
+	return converted
+}
+
+// convertSubflowToNodeRedFormat flattens a subflow the way /flows stores it:
+// the template followed by its nodes and config nodes, placed on the
+// subflow with z
+func convertSubflowToNodeRedFormat(subflow types.SubflowDefinition) []map[string]interface{} {
+	nodes := []map[string]interface{}{convertSubflowTemplate(subflow)}
+	for _, node := range subflow.Nodes {
+		nodes = append(nodes, convertNodeToNodeRedFormat(node, subflow.ID))
+	}
+	for _, config := range subflow.Configs {
+		nodes = append(nodes, convertConfigToNodeRedFormat(config, subflow.ID))
+	}
+	return nodes
+}
+
+// convertSubflowToNested converts a subflow into the form used by /flow/:id,
+// which nests the subflow's nodes and configs in the template
+func convertSubflowToNested(subflow types.SubflowDefinition) map[string]interface{} {
+	template := convertSubflowTemplate(subflow)
+	nodes := make([]map[string]interface{}, 0, len(subflow.Nodes))
+	for _, node := range subflow.Nodes {
+		nodes = append(nodes, convertNodeToNodeRedFormat(node, subflow.ID))
+	}
+	template["nodes"] = nodes
+	if len(subflow.Configs) > 0 {
+		configs := make([]map[string]interface{}, 0, len(subflow.Configs))
+		for _, config := range subflow.Configs {
+			configs = append(configs, convertConfigToNodeRedFormat(config, subflow.ID))
+		}
+		template["configs"] = configs
+	}
+	return template
+}
+
+// convertNodeRedToSubflow reads a subflow template in the nested /flow/:id
+// form
+func convertNodeRedToSubflow(raw map[string]interface{}) (types.SubflowDefinition, error) {
+	subflow := types.SubflowDefinition{
+		In:    []types.SubflowPort{},
+		Out:   []types.SubflowPort{},
+		Nodes: []types.Node{},
+	}
+	subflow.ID, _ = raw["id"].(string)
+	subflow.Name, _ = raw["name"].(string)
+	subflow.Info, _ = raw["info"].(string)
+	subflow.Category, _ = raw["category"].(string)
+
+	for key, ports := range map[string]*[]types.SubflowPort{"in": &subflow.In, "out": &subflow.Out} {
+		if raw[key] == nil {
+			continue
+		}
+		var parsed []nodeRedPort
+		if err := remarshal(raw[key], &parsed); err != nil {
+			return subflow, fmt.Errorf("subflow %s: invalid %s: %w", subflow.ID, key, err)
+		}
+		for _, port := range parsed {
+			if port.Wires == nil {
+				port.Wires = []types.SubflowWire{}
+			}
+			*ports = append(*ports, types.SubflowPort{Position: types.Position{X: port.X, Y: port.Y}, Wires: port.Wires})
+		}
+	}
+
+	if err := readEnv(raw, &subflow.Env); err != nil {
+		return subflow, fmt.Errorf("subflow %s: invalid env: %w", subflow.ID, err)
+	}
+
+	nodes, err := convertNodeRedNodes(raw["nodes"])
+	if err != nil {
+		return subflow, fmt.Errorf("subflow %s: invalid nodes: %w", subflow.ID, err)
+	}
+	if nodes != nil {
+		subflow.Nodes = nodes
+	}
+	if subflow.Configs, err = convertNodeRedNodes(raw["configs"]); err != nil {
+		return subflow, fmt.Errorf("subflow %s: invalid configs: %w", subflow.ID, err)
+	}
+
+	for key, value := range raw {
+		if subflowFields[key] {
+			continue
+		}
+		if subflow.Properties == nil {
+			subflow.Properties = make(map[string]interface{})
+		}
+		subflow.Properties[key] = value
+	}
+
+	return subflow, nil
+}
+
+// convertNodeRedNodes converts a JSON array of Node-RED nodes
+func convertNodeRedNodes(value interface{}) ([]types.Node, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, nil
+	}
+
+	nodes := make([]types.Node, 0, len(items))
+	for _, item := range items {
+		raw, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected node object, got %T", item)
+		}
+		node, err := convertNodeRedToNode(raw)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// parseWires converts the generic JSON form of a wires array into [][]string
+func parseWires(value interface{}) ([][]string, error) {
+	outputs, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("wires must be an array, got %T", value)
+	}
+
+	wires := make([][]string, 0, len(outputs))
+	for _, output := range outputs {
+		targets, ok := output.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("wire output must be an array, got %T", output)
+		}
+		ids := make([]string, 0, len(targets))
+		for _, target := range targets {
+			id, ok := target.(string)
+			if !ok {
+				return nil, fmt.Errorf("wire target must be a string, got %T", target)
+			}
+			ids = append(ids, id)
+		}
+		wires = append(wires, ids)
+	}
+	return wires, nil
+}
+
+// toFloat reads a JSON number, tolerating the string coordinates some
+// Node-RED versions and hand-edited files contain
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case string:
+		var f float64
+		_, _ = fmt.Sscanf(v, "%g", &f)
+		return f
+	default:
+		return 0
+	}
+}
+
+// remarshal converts a generic JSON value into a typed one
+func remarshal(in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// GroupFlows is the inverse of FlattenFlows: it groups the flat node array of
+// a flows file or /flows response into one FlowDefinition per tab, in file
+// order. Each tab carries the subflow templates its nodes use, directly or
+// through other subflows. Config nodes on no tab and subflows no tab uses go
+// to a last flow with ID types.GlobalFlowID. Credentials, keyed by node ID as
+// in a flows_cred.json file, are merged into each node's "credentials".
+func GroupFlows(nodes []map[string]interface{}, credentials map[string]map[string]interface{}) ([]*types.FlowDefinition, error) {
+	var tabs []map[string]interface{}
+	byTab := make(map[string]map[string]interface{})
+	var subflowOrder []string
+	subflows := make(map[string]map[string]interface{})
+
+	for _, raw := range nodes {
+		id, _ := raw["id"].(string)
+		switch raw["type"] {
+		case "tab":
+			tab := withCredentials(copyNode(raw), credentials[id])
+			tab["nodes"], tab["configs"] = []interface{}{}, []interface{}{}
+			tabs = append(tabs, tab)
+			byTab[id] = tab
+		case "subflow":
+			subflow := withCredentials(copyNode(raw), credentials[id])
+			subflow["nodes"], subflow["configs"] = []interface{}{}, []interface{}{}
+			subflowOrder = append(subflowOrder, id)
+			subflows[id] = subflow
+		}
+	}
+
+	global := map[string]interface{}{"id": types.GlobalFlowID, "configs": []interface{}{}}
+	uses := make(map[string][]string)
+	for _, raw := range nodes {
+		if raw["type"] == "tab" || raw["type"] == "subflow" {
+			continue
+		}
+		id, _ := raw["id"].(string)
+		node := withCredentials(copyNode(raw), credentials[id])
+		z, _ := raw["z"].(string)
+		if subflowID, ok := strings.CutPrefix(fmt.Sprint(raw["type"]), "subflow:"); ok {
+			uses[z] = append(uses[z], subflowID)
+		}
+
+		// Nodes on the canvas have a position; config nodes never do
+		_, drawn := raw["x"]
+		switch {
+		case byTab[z] != nil && drawn:
+			byTab[z]["nodes"] = append(byTab[z]["nodes"].([]interface{}), node)
+		case byTab[z] != nil:
+			byTab[z]["configs"] = append(byTab[z]["configs"].([]interface{}), node)
+		case subflows[z] != nil && drawn:
+			subflows[z]["nodes"] = append(subflows[z]["nodes"].([]interface{}), node)
+		case subflows[z] != nil:
+			subflows[z]["configs"] = append(subflows[z]["configs"].([]interface{}), node)
+		case z == "":
+			global["configs"] = append(global["configs"].([]interface{}), node)
+		default:
+			return nil, fmt.Errorf("node %s is on unknown flow %s", id, z)
+		}
+	}
+
+	used := make(map[string]bool)
+	flows := make([]*types.FlowDefinition, 0, len(tabs)+1)
+	for _, tab := range tabs {
+		id, _ := tab["id"].(string)
+		needed := subflowsUsed(id, uses)
+		var attached []interface{}
+		for _, subflowID := range subflowOrder {
+			if needed[subflowID] {
+				attached = append(attached, subflows[subflowID])
+				used[subflowID] = true
+			}
+		}
+		tab["subflows"] = attached
+
+		flow, err := convertNodeRedToFlow(tab)
+		if err != nil {
+			return nil, fmt.Errorf("flow %s: %w", id, err)
+		}
+		flows = append(flows, flow)
+	}
+
+	var unused []interface{}
+	for _, subflowID := range subflowOrder {
+		if !used[subflowID] {
+			unused = append(unused, subflows[subflowID])
+		}
+	}
+	global["subflows"] = unused
+	if len(global["configs"].([]interface{})) > 0 || len(unused) > 0 {
+		flow, err := convertNodeRedToFlow(global)
+		if err != nil {
+			return nil, fmt.Errorf("flow %s: %w", types.GlobalFlowID, err)
+		}
+		flows = append(flows, flow)
+	}
+
+	return flows, nil
+}
+
+// subflowsUsed follows the subflow instances of a tab into the subflows they
+// instantiate, returning every subflow the tab depends on
+func subflowsUsed(tabID string, uses map[string][]string) map[string]bool {
+	needed := make(map[string]bool)
+	queue := append([]string(nil), uses[tabID]...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if !needed[id] {
+			needed[id] = true
+			queue = append(queue, uses[id]...)
+		}
+	}
+	return needed
+}
+
+// copyNode returns a shallow copy of a raw node, so grouping never modifies
+// the caller's nodes
+func copyNode(raw map[string]interface{}) map[string]interface{} {
+	node := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		node[key] = value
+	}
+	return node
+}
+
+// withCredentials merges credentials from a separate section into those the
+// node carries inline; the section wins for fields set in both
+func withCredentials(node map[string]interface{}, credentials map[string]interface{}) map[string]interface{} {
+	if len(credentials) == 0 {
+		return node
+	}
+	merged := make(map[string]interface{}, len(credentials))
+	if inline, ok := node["credentials"].(map[string]interface{}); ok {
+		for key, value := range inline {
+			merged[key] = value
+		}
+	}
+	for key, value := range credentials {
+		merged[key] = value
+	}
+	node["credentials"] = merged
+	return node
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// maxErrorBody bounds how much of an error response is kept in an APIError
+const maxErrorBody = 64 << 10
+
+// newAPIError builds an APIError from a non-successful response, parsing
+// Node-RED's {"code": ..., "message": ...} error body when present. cause is
+// an optional more specific error, such as types.ErrFlowNotFound.
+func newAPIError(resp *http.Response, cause error) *types.APIError {
+	apiErr := &types.APIError{
+		StatusCode: resp.StatusCode,
+		Err:        cause,
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.URL = resp.Request.URL.String()
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	apiErr.Body = strings.TrimSpace(string(body))
+
+	var payload struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.Code = payload.Code
+		apiErr.Message = payload.Message
+		// The auth endpoints answer with OAuth style {"error": ...} bodies
+		if apiErr.Code == "" {
+			apiErr.Code = payload.Error
+		}
+	}
+
+	return apiErr
+}
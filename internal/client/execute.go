@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// ExecutionIDHeader carries the execution ID to and from the managed endpoint
+const ExecutionIDHeader = "X-Execution-Id"
+
+// executionPathPrefix is the http in route prefix used for managed execution endpoints
+const executionPathPrefix = "/yoyo/execute/"
+
+// ExecutionPath returns the http in route used to execute the given flow
+func ExecutionPath(flowID string) string {
+	return executionPathPrefix + url.PathEscape(flowID)
+}
+
+// ExecuteFlow triggers a flow execution by calling the flow's managed http in
+// endpoint. The input is sent as the request body, so it becomes msg.payload;
+// whatever the flow sends to its http response node becomes the Output.
+// Non-2xx responses produce an unsuccessful result rather than an error.
+func (c *NodeRedClient) ExecuteFlow(ctx context.Context, flowID string, input map[string]interface{}) (*types.ExecutionResult, error) {
+	url := c.httpURL + ExecutionPath(flowID)
+
+	jsonData, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	executionID, err := newExecutionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate execution ID: %w", err)
+	}
+
+	c.logger.Debug("executing flow", "flow_id", flowID, "execution_id", executionID)
+
+	header := http.Header{}
+	header.Set(ExecutionIDHeader, executionID)
+
+	// Executions are not idempotent, so they are never retried. The admin
+	// token is not sent to http in routes.
+	startTime := time.Now()
+	resp, err := c.send(ctx, "POST", url, jsonData, header, sendOptions{execution: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute flow: %w", err)
+	}
+	defer c.closeResponseBody(resp)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound && isNodeRedNotFound(body) {
+		apiErr := &types.APIError{
+			StatusCode: resp.StatusCode,
+			Method:     "POST",
+			URL:        url,
+			Body:       strings.TrimSpace(string(body)),
+			Err:        types.ErrFlowNotFound,
+		}
+		return nil, fmt.Errorf("flow %s has no execution endpoint; deploy it with an execution endpoint enabled: %w", flowID, apiErr)
+	}
+
+	result := &types.ExecutionResult{
+		ExecutionID: executionID,
+		Success:     resp.StatusCode >= 200 && resp.StatusCode < 300,
+		Output:      decodeExecutionOutput(body),
+		Duration:    time.Since(startTime),
+	}
+	if id := resp.Header.Get(ExecutionIDHeader); id != "" {
+		result.ExecutionID = id
+	}
+	if !result.Success {
+		result.Error = fmt.Sprintf("flow returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return result, nil
+}
+
+// decodeExecutionOutput maps an http response body onto ExecutionResult.Output.
+// JSON objects are used as-is; any other body is wrapped under "payload".
+func decodeExecutionOutput(body []byte) map[string]interface{} {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return map[string]interface{}{}
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return map[string]interface{}{"payload": string(body)}
+	}
+
+	if output, ok := value.(map[string]interface{}); ok {
+		return output
+	}
+	return map[string]interface{}{"payload": value}
+}
+
+// isNodeRedNotFound reports whether a 404 body is Node-RED's own "no route"
+// page rather than a response produced by the flow
+func isNodeRedNotFound(body []byte) bool {
+	return strings.Contains(string(body), "Cannot POST")
+}
+
+// newExecutionID returns a random 128-bit hex identifier
+func newExecutionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// apiVersionHeader selects the /flows response format; v2 wraps the flows
+// together with their revision
+const apiVersionHeader = "Node-RED-API-Version"
+
+// deploymentTypeHeader selects which nodes a POST /flows restarts
+const deploymentTypeHeader = "Node-RED-Deployment-Type"
+
+// GetFlowConfig retrieves the complete flow configuration and its revision
+func (c *NodeRedClient) GetFlowConfig(ctx context.Context) (*types.FlowConfig, error) {
+	url := fmt.Sprintf("%s/flows", c.baseURL)
+
+	header := http.Header{}
+	header.Set(apiVersionHeader, "v2")
+
+	resp, err := c.doRequest(ctx, "GET", url, nil, header, c.retry.maxRetries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flows: %w", err)
+	}
+	defer c.closeResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get flows: %w", newAPIError(resp, nil))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flows response: %w", err)
+	}
+
+	// Node-RED versions without v2 support return a bare array and no revision
+	var config types.FlowConfig
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &config.Flows)
+	} else {
+		err = json.Unmarshal(body, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode flows response: %w", err)
+	}
+
+	return &config, nil
+}
+
+// DeployAll replaces the complete flow configuration with the given flows
+// using POST /flows. When rev is non-empty Node-RED rejects the deploy with
+// types.ErrConflict if the flows changed since that revision; an empty rev
+// forces the deploy. deployType decides which nodes Node-RED restarts and
+// defaults to a full deploy. The new revision is returned.
+func (c *NodeRedClient) DeployAll(ctx context.Context, flows []*types.FlowDefinition, rev string, deployType types.DeploymentType) (string, error) {
+	if deployType == types.DeployReload {
+		return "", fmt.Errorf("failed to deploy flows: use ReloadFlows to reload without deploying")
+	}
+	if !deployType.Valid() {
+		return "", fmt.Errorf("failed to deploy flows: unknown deployment type %q", deployType)
+	}
+
+	reconciled := make([]*types.FlowDefinition, 0, len(flows))
+	for _, flow := range flows {
+		flow, err := flow.Reconciled()
+		if err != nil {
+			return "", fmt.Errorf("failed to deploy flows: %w", err)
+		}
+		reconciled = append(reconciled, flow)
+	}
+
+	payload := map[string]interface{}{
+		"flows": FlattenFlows(reconciled),
+	}
+	if rev != "" {
+		payload["rev"] = rev
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal flows: %w", err)
+	}
+
+	c.logger.Debug("deploying all flows", "flows", len(flows), "deployment_type", deployType, "rev", rev)
+
+	newRev, err := c.postFlows(ctx, jsonData, deployType)
+	if err != nil {
+		if errors.Is(err, types.ErrConflict) {
+			return "", fmt.Errorf("failed to deploy flows: revision %s is stale: %w", rev, err)
+		}
+		return "", fmt.Errorf("failed to deploy flows: %w", err)
+	}
+
+	return newRev, nil
+}
+
+// ReloadFlows makes Node-RED stop all flows and start them again from its
+// storage, without deploying anything new. The new revision is returned.
+func (c *NodeRedClient) ReloadFlows(ctx context.Context) (string, error) {
+	c.logger.Debug("reloading flows")
+
+	// Node-RED ignores the body of a reload, but still expects the v2 shape
+	rev, err := c.postFlows(ctx, []byte(`{"flows":[]}`), types.DeployReload)
+	if err != nil {
+		return "", fmt.Errorf("failed to reload flows: %w", err)
+	}
+
+	return rev, nil
+}
+
+// postFlows sends a POST /flows request with the given deployment type and
+// returns the revision reported by Node-RED
+func (c *NodeRedClient) postFlows(ctx context.Context, jsonData []byte, deployType types.DeploymentType) (string, error) {
+	url := fmt.Sprintf("%s/flows", c.baseURL)
+
+	header := http.Header{}
+	header.Set(apiVersionHeader, "v2")
+	if deployType != "" {
+		header.Set(deploymentTypeHeader, string(deployType))
+	}
+
+	resp, err := c.doRequest(ctx, "POST", url, jsonData, header, c.retry.maxRetries)
+	if err != nil {
+		return "", err
+	}
+	defer c.closeResponseBody(resp)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return "", newAPIError(resp, nil)
+	}
+
+	var result struct {
+		Rev string `json:"rev"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to decode deploy response: %w", err)
+		}
+	}
+
+	return result.Rev, nil
+}
+
+// FlattenFlows converts flow definitions into the flat node array used by
+// /flows and flows files. The subflow templates the flows carry come first,
+// deduplicated by ID and ordered so that every template precedes the
+// subflows using it, since Node-RED creates instances from templates it has
+// already seen. Each tab then follows with its nodes and config nodes. The
+// flow with ID types.GlobalFlowID has no tab; its config nodes are written
+// without z.
+func FlattenFlows(flows []*types.FlowDefinition) []map[string]interface{} {
+	nodes := []map[string]interface{}{}
+
+	var subflows []types.SubflowDefinition
+	seenSubflows := make(map[string]bool)
+	for _, flow := range flows {
+		for _, subflow := range flow.Subflows {
+			if !seenSubflows[subflow.ID] {
+				seenSubflows[subflow.ID] = true
+				subflows = append(subflows, subflow)
+			}
+		}
+	}
+	for _, subflow := range types.OrderSubflows(subflows) {
+		nodes = append(nodes, convertSubflowToNodeRedFormat(subflow)...)
+	}
+
+	for _, flow := range flows {
+		z := flow.ID
+		if flow.ID == types.GlobalFlowID {
+			z = ""
+		} else {
+			nodes = append(nodes, convertFlowToNodeRedFormat(flow)...)
+		}
+
+		for _, config := range flow.Configs {
+			nodes = append(nodes, convertConfigToNodeRedFormat(config, z))
+		}
+	}
+
+	return nodes
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// redacted replaces secret values in logged payloads
+const redacted = "[REDACTED]"
+
+// maxLoggedBody bounds the size of a payload written to the log
+const maxLoggedBody = 4 << 10
+
+// secretKeys are substrings of JSON keys whose values are never logged,
+// matched case-insensitively after removing "_" and "-"
+var secretKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"apikey",
+	"authorization",
+	"credentials",
+	"privatekey",
+}
+
+// newLogger returns the logger configured on the config, or a log/slog logger
+// built from its logging settings. Debug forces the debug level.
+func newLogger(config *types.Config) types.Logger {
+	if config.Logger != nil {
+		return config.Logger
+	}
+
+	level := slog.LevelWarn
+	format := ""
+	if config.Logging != nil {
+		format = config.Logging.Format
+		if config.Logging.Level != "" {
+			if err := level.UnmarshalText([]byte(config.Logging.Level)); err != nil {
+				level = slog.LevelWarn
+			}
+		}
+	}
+	if config.Debug {
+		level = slog.LevelDebug
+	}
+
+	return newSlogLogger(os.Stderr, format, level)
+}
+
+// newSlogLogger returns a log/slog logger writing text or JSON records to w
+func newSlogLogger(w io.Writer, format string, level slog.Level) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// redactBody renders a request or response body for logging with the values
+// of secret-looking keys replaced. Bodies that are not JSON are summarized by
+// size, since their content cannot be checked for secrets.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	if len(data) > maxLoggedBody {
+		return string(data[:maxLoggedBody]) + "...(truncated)"
+	}
+	return string(data)
+}
+
+// redactValue walks a decoded JSON value, replacing secrets
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if isSecretKey(key) {
+				result[key] = redacted
+			} else {
+				result[key] = redactValue(item)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = redactValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// isSecretKey reports whether values stored under the key must not be logged
+func isSecretKey(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	for _, secret := range secretKeys {
+		if strings.Contains(normalized, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+const (
+	defaultInitialDelay  = 500 * time.Millisecond
+	defaultMaxDelay      = 30 * time.Second
+	defaultBackoffFactor = 2.0
+)
+
+// retryPolicy controls how failed requests to Node-RED are retried
+type retryPolicy struct {
+	maxRetries    int
+	initialDelay  time.Duration
+	maxDelay      time.Duration
+	backoffFactor float64
+}
+
+// newRetryPolicy builds a retry policy from the config, falling back to
+// RetryAttempts and sensible defaults for anything left unset
+func newRetryPolicy(config *types.Config) retryPolicy {
+	policy := retryPolicy{
+		maxRetries:    config.RetryAttempts,
+		initialDelay:  defaultInitialDelay,
+		maxDelay:      defaultMaxDelay,
+		backoffFactor: defaultBackoffFactor,
+	}
+
+	if rp := config.RetryPolicy; rp != nil {
+		if rp.MaxRetries > 0 {
+			policy.maxRetries = rp.MaxRetries
+		}
+		if rp.InitialDelay > 0 {
+			policy.initialDelay = rp.InitialDelay
+		}
+		if rp.MaxDelay > 0 {
+			policy.maxDelay = rp.MaxDelay
+		}
+		if rp.BackoffFactor >= 1 {
+			policy.backoffFactor = rp.BackoffFactor
+		}
+	}
+
+	if policy.maxRetries < 0 {
+		policy.maxRetries = 0
+	}
+	if policy.maxDelay < policy.initialDelay {
+		policy.maxDelay = policy.initialDelay
+	}
+
+	return policy
+}
+
+// backoff returns the delay before the given retry attempt (starting at 1).
+// Half of the exponential delay is fixed and the other half is randomized so
+// that clients restarting together do not hammer Node-RED in lockstep.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.initialDelay) * math.Pow(p.backoffFactor, float64(attempt-1))
+	if delay > float64(p.maxDelay) {
+		delay = float64(p.maxDelay)
+	}
+
+	half := delay / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// isRetryableStatus reports whether an HTTP status indicates a transient failure
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// isRetryableError reports whether a transport error is worth retrying.
+// Network-level failures (timeouts, resets, refused connections) are transient;
+// anything else, such as a malformed URL or TLS verification failure, is not.
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isConnectError reports whether a transport error happened while connecting,
+// before any of the request was sent
+func isConnectError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryAfter parses the Retry-After header, which may be given either in
+// seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		delay := time.Until(when)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,384 @@
+// Package diff compares two versions of a flow. It reports the nodes that were
+// added, removed or modified, down to the property that changed, the wires
+// that were added or removed and the changes to the tab itself, so a redeploy
+// can be reviewed before it is made.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// Kind is what happened to a node, property or wire
+type Kind string
+
+const (
+	Added    Kind = "added"
+	Removed  Kind = "removed"
+	Modified Kind = "modified"
+)
+
+// Change is a change to a single value, identified by its JSON path relative
+// to the node or tab, e.g. properties.rules[0].to. Old is unset for added
+// values and New for removed ones.
+type Change struct {
+	Kind Kind        `json:"kind"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// NodeChange is a node or config node that was added, removed or modified.
+// Changes lists the modified values; wiring changes are reported as
+// WireChanges instead.
+type NodeChange struct {
+	Kind    Kind     `json:"kind"`
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// WireChange is a wire from an output port of one node to another that was
+// added or removed
+type WireChange struct {
+	Kind       Kind   `json:"kind"`
+	Source     string `json:"source"`
+	SourcePort int    `json:"source_port"`
+	Target     string `json:"target"`
+}
+
+// Result is the difference between two versions of a flow
+type Result struct {
+	FlowID string       `json:"flow_id"`
+	Flow   []Change     `json:"flow,omitempty"`
+	Nodes  []NodeChange `json:"nodes,omitempty"`
+	Wires  []WireChange `json:"wires,omitempty"`
+}
+
+// Empty reports whether the two flows are the same
+func (r *Result) Empty() bool {
+	return len(r.Flow) == 0 && len(r.Nodes) == 0 && len(r.Wires) == 0
+}
+
+// Option changes what Diff compares
+type Option func(*options)
+
+type options struct {
+	ignorePositions bool
+}
+
+// IgnorePositions leaves out changes to node positions, which only affect how
+// the flow looks in the editor
+func IgnorePositions() Option {
+	return func(o *options) {
+		o.ignorePositions = true
+	}
+}
+
+// flowOnly are the fields of a FlowDefinition that are not compared as tab
+// metadata: nodes and wiring are compared separately, and the timestamps
+// change on every save
+var flowOnly = []string{"nodes", "configs", "connections", "created_at", "updated_at"}
+
+// Diff compares two versions of a flow. Either may be nil, in which case
+// every node of the other is reported as added or removed. Nodes are matched
+// by ID; config nodes are compared like nodes. Wiring given only as
+// Connections is taken into account.
+func Diff(old, new *types.FlowDefinition, opts ...Option) *Result {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	old, new = reconcile(old), reconcile(new)
+	result := &Result{FlowID: new.ID}
+	if result.FlowID == "" {
+		result.FlowID = old.ID
+	}
+
+	result.Flow = compare("", normalize(old, flowOnly...), normalize(new, flowOnly...), nil)
+	result.Nodes = diffNodes(allNodes(old), allNodes(new), o)
+	result.Wires = diffWires(old.Connections, new.Connections)
+	return result
+}
+
+// reconcile returns a flow whose Connections match the nodes' wires, or an
+// empty flow for nil
+func reconcile(flow *types.FlowDefinition) *types.FlowDefinition {
+	if flow == nil {
+		return &types.FlowDefinition{}
+	}
+	// Conflicting wiring is reported by flow.Validate; the wires win here
+	reconciled, _ := flow.Reconciled()
+	return reconciled
+}
+
+// allNodes lists the config nodes of a flow followed by its nodes
+func allNodes(flow *types.FlowDefinition) []types.Node {
+	nodes := make([]types.Node, 0, len(flow.Configs)+len(flow.Nodes))
+	return append(append(nodes, flow.Configs...), flow.Nodes...)
+}
+
+// diffNodes lists removed nodes in their old order, followed by added and
+// modified nodes in their new order
+func diffNodes(old, new []types.Node, o options) []NodeChange {
+	ignored := []string{"id", "wires"}
+	if o.ignorePositions {
+		ignored = append(ignored, "position")
+	}
+
+	previous := make(map[string]types.Node, len(old))
+	for _, node := range old {
+		previous[node.ID] = node
+	}
+	current := make(map[string]bool, len(new))
+	for _, node := range new {
+		current[node.ID] = true
+	}
+
+	var changes []NodeChange
+	for _, node := range old {
+		if !current[node.ID] {
+			changes = append(changes, NodeChange{Kind: Removed, ID: node.ID, Type: node.Type, Name: node.Name})
+		}
+	}
+	for _, node := range new {
+		before, ok := previous[node.ID]
+		if !ok {
+			changes = append(changes, NodeChange{Kind: Added, ID: node.ID, Type: node.Type, Name: node.Name})
+			continue
+		}
+		if values := compare("", normalize(before, ignored...), normalize(node, ignored...), nil); len(values) > 0 {
+			changes = append(changes, NodeChange{Kind: Modified, ID: node.ID, Type: node.Type, Name: node.Name, Changes: values})
+		}
+	}
+	return changes
+}
+
+// diffWires lists removed wires followed by added ones
+func diffWires(old, new []types.Connection) []WireChange {
+	key := func(c types.Connection) types.Connection {
+		return types.Connection{Source: c.Source, Target: c.Target, SourcePort: c.SourcePort}
+	}
+	previous := make(map[types.Connection]bool, len(old))
+	for _, c := range old {
+		previous[key(c)] = true
+	}
+	current := make(map[types.Connection]bool, len(new))
+	for _, c := range new {
+		current[key(c)] = true
+	}
+
+	var changes []WireChange
+	for _, c := range old {
+		if !current[key(c)] {
+			changes = append(changes, WireChange{Kind: Removed, Source: c.Source, SourcePort: c.SourcePort, Target: c.Target})
+		}
+	}
+	for _, c := range new {
+		if !previous[key(c)] {
+			changes = append(changes, WireChange{Kind: Added, Source: c.Source, SourcePort: c.SourcePort, Target: c.Target})
+		}
+	}
+	return changes
+}
+
+// normalize converts a value to its JSON form, so that values built in Go
+// ([]string, int) compare equal to the same values decoded from Node-RED
+// ([]interface{}, float64), and drops the given top-level fields
+func normalize(v interface{}, drop ...string) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	for _, field := range drop {
+		delete(generic, field)
+	}
+	return generic
+}
+
+// compare appends the changes between two JSON values under path. Objects are
+// compared key by key and arrays index by index; anything else is compared as
+// a whole. Null, empty objects and empty arrays are treated as the same.
+func compare(path string, old, new interface{}, changes []Change) []Change {
+	if empty(old) && empty(new) {
+		return changes
+	}
+
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inOld:
+				changes = append(changes, Change{Kind: Added, Path: join(path, k), New: nv})
+			case !inNew:
+				changes = append(changes, Change{Kind: Removed, Path: join(path, k), Old: ov})
+			default:
+				changes = compare(join(path, k), ov, nv, changes)
+			}
+		}
+		return changes
+
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			elem := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(o):
+				changes = append(changes, Change{Kind: Added, Path: elem, New: n[i]})
+			case i >= len(n):
+				changes = append(changes, Change{Kind: Removed, Path: elem, Old: o[i]})
+			default:
+				changes = compare(elem, o[i], n[i], changes)
+			}
+		}
+		return changes
+	}
+
+	if !equal(old, new) {
+		changes = append(changes, Change{Kind: Modified, Path: path, Old: old, New: new})
+	}
+	return changes
+}
+
+func empty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// equal compares two JSON scalars, or values of different JSON types
+func equal(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// join appends a key to a JSON path, quoting keys that are not identifiers
+func join(path, key string) string {
+	if !identifier.MatchString(key) {
+		quoted, _ := json.Marshal(key)
+		return path + "[" + string(quoted) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Text renders the result for logs and PR comments, one line per change in the
+// style of a unified diff: + for added, - for removed and ~ for modified.
+// Wrapped in a ```diff block, the prefixes are highlighted on GitHub.
+func (r *Result) Text() string {
+	var b strings.Builder
+	if r.Empty() {
+		fmt.Fprintf(&b, "flow %s: no changes\n", r.FlowID)
+		return b.String()
+	}
+
+	counts := map[Kind]int{}
+	for _, node := range r.Nodes {
+		counts[node.Kind]++
+	}
+	fmt.Fprintf(&b, "flow %s: %d added, %d removed, %d modified nodes, %d wire changes\n",
+		r.FlowID, counts[Added], counts[Removed], counts[Modified], len(r.Wires))
+
+	if len(r.Flow) > 0 {
+		b.WriteString("~ tab\n")
+		writeChanges(&b, r.Flow)
+	}
+	for _, node := range r.Nodes {
+		fmt.Fprintf(&b, "%s node %s (%s", prefix(node.Kind), node.ID, node.Type)
+		if node.Name != "" {
+			fmt.Fprintf(&b, " %q", node.Name)
+		}
+		b.WriteString(")\n")
+		writeChanges(&b, node.Changes)
+	}
+	for _, wire := range r.Wires {
+		fmt.Fprintf(&b, "%s wire %s[%d] -> %s\n", prefix(wire.Kind), wire.Source, wire.SourcePort, wire.Target)
+	}
+	return b.String()
+}
+
+func writeChanges(b *strings.Builder, changes []Change) {
+	for _, change := range changes {
+		switch change.Kind {
+		case Added:
+			fmt.Fprintf(b, "%s   %s: %s\n", prefix(Added), change.Path, render(change.New))
+		case Removed:
+			fmt.Fprintf(b, "%s   %s: %s\n", prefix(Removed), change.Path, render(change.Old))
+		default:
+			fmt.Fprintf(b, "%s   %s: %s -> %s\n", prefix(Modified), change.Path, render(change.Old), render(change.New))
+		}
+	}
+}
+
+func prefix(kind Kind) string {
+	switch kind {
+	case Added:
+		return "+"
+	case Removed:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// render formats a value as compact JSON, shortening long values such as
+// function code so that a line stays readable
+func render(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	const limit = 80
+	if s := string(data); len(s) > limit {
+		return s[:limit-3] + "..."
+	}
+	return string(data)
+}
+
+// JSON renders the result as indented JSON for tools that post-process it
+func (r *Result) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
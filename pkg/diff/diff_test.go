@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+func oldFlow() *types.FlowDefinition {
+	return &types.FlowDefinition{
+		ID:    "tab",
+		Label: "Orders",
+		Nodes: []types.Node{
+			{ID: "in", Type: "inject", Position: types.Position{X: 100, Y: 60}, Wires: [][]string{{"fn"}}},
+			{ID: "fn", Type: "function", Name: "route", Properties: map[string]interface{}{
+				"func":    "return msg;",
+				"outputs": 1,
+				"libs":    []string{"a"},
+			}, Wires: [][]string{{"debug"}}},
+			{ID: "debug", Type: "debug"},
+		},
+	}
+}
+
+func TestDiff_NoChanges(t *testing.T) {
+	// Values decoded from JSON compare equal to the Go values they came from
+	decoded := oldFlow()
+	decoded.Nodes[1].Properties = map[string]interface{}{
+		"func":    "return msg;",
+		"outputs": 1.0,
+		"libs":    []interface{}{"a"},
+	}
+	decoded.Nodes[0].Wires = nil
+	decoded.Nodes[2].Properties = map[string]interface{}{}
+	decoded.Connections = []types.Connection{{Source: "in", Target: "fn"}}
+
+	result := Diff(oldFlow(), decoded)
+	assert.True(t, result.Empty(), result.Text())
+	assert.Equal(t, "flow tab: no changes\n", result.Text())
+}
+
+func TestDiff_Changes(t *testing.T) {
+	new := oldFlow()
+	new.Label = "Orders v2"
+	new.Nodes[0].Position.X = 140
+	new.Nodes[1].Properties = map[string]interface{}{
+		"func":     "msg.payload = 1;\nreturn msg;",
+		"outputs":  1,
+		"libs":     []string{"a", "b"},
+		"my.field": true,
+	}
+	new.Nodes[1].Wires = [][]string{{"log"}}
+	new.Nodes = append(new.Nodes[:2], types.Node{ID: "log", Type: "debug", Name: "log"})
+
+	result := Diff(oldFlow(), new)
+	assert.Equal(t, "tab", result.FlowID)
+	assert.Equal(t, []Change{{Kind: Modified, Path: "label", Old: "Orders", New: "Orders v2"}}, result.Flow)
+
+	require.Len(t, result.Nodes, 4)
+	assert.Equal(t, NodeChange{Kind: Removed, ID: "debug", Type: "debug"}, result.Nodes[0])
+	assert.Equal(t, NodeChange{Kind: Modified, ID: "in", Type: "inject", Changes: []Change{
+		{Kind: Modified, Path: "position.x", Old: 100.0, New: 140.0},
+	}}, result.Nodes[1])
+	assert.Equal(t, []Change{
+		{Kind: Modified, Path: "properties.func", Old: "return msg;", New: "msg.payload = 1;\nreturn msg;"},
+		{Kind: Added, Path: "properties.libs[1]", New: "b"},
+		{Kind: Added, Path: `properties["my.field"]`, New: true},
+	}, result.Nodes[2].Changes)
+	assert.Equal(t, NodeChange{Kind: Added, ID: "log", Type: "debug", Name: "log"}, result.Nodes[3])
+
+	assert.Equal(t, []WireChange{
+		{Kind: Removed, Source: "fn", Target: "debug"},
+		{Kind: Added, Source: "fn", Target: "log"},
+	}, result.Wires)
+
+	assert.Equal(t, `flow tab: 1 added, 1 removed, 2 modified nodes, 2 wire changes
+~ tab
+~   label: "Orders" -> "Orders v2"
+- node debug (debug)
+~ node in (inject)
+~   position.x: 100 -> 140
+~ node fn (function "route")
+~   properties.func: "return msg;" -> "msg.payload = 1;\nreturn msg;"
++   properties.libs[1]: "b"
++   properties["my.field"]: true
++ node log (debug "log")
+- wire fn[0] -> debug
++ wire fn[0] -> log
+`, result.Text())
+
+	data, err := result.JSON()
+	require.NoError(t, err)
+	var decoded Result
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, result.Wires, decoded.Wires)
+	assert.Len(t, decoded.Nodes, 4)
+
+	ignoring := Diff(oldFlow(), new, IgnorePositions())
+	assert.Len(t, ignoring.Nodes, 3, "the moved inject node is not reported")
+}
+
+func TestDiff_Nil(t *testing.T) {
+	result := Diff(nil, oldFlow())
+	assert.Equal(t, "tab", result.FlowID)
+	require.Len(t, result.Nodes, 3)
+	for _, node := range result.Nodes {
+		assert.Equal(t, Added, node.Kind)
+	}
+	assert.Len(t, result.Wires, 2)
+
+	removed := Diff(oldFlow(), nil)
+	assert.Equal(t, Removed, removed.Nodes[0].Kind)
+}
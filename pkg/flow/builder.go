@@ -0,0 +1,341 @@
+// Package flow builds FlowDefinitions with a fluent API, generating node IDs
+// and wires from the order nodes are chained in:
+//
+//	def, err := flow.New("orders").
+//		Inject("Start").
+//		Then(flow.Function("return msg;")).
+//		Then(flow.Debug()).
+//		Build()
+package flow
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// NodeSpec is a node to add to a flow. The builder assigns its ID, unless the
+// node already has one, and computes its wires.
+type NodeSpec interface {
+	// ToNode returns the node without wires, or an error when its properties
+	// cannot be encoded
+	ToNode() (types.Node, error)
+	// Outputs returns the number of output ports of the node
+	Outputs() int
+}
+
+// Spec is a generic NodeSpec for any node type
+type Spec struct {
+	ID         string
+	Type       string
+	Name       string
+	Position   types.Position
+	Properties map[string]interface{}
+	Ports      int
+}
+
+// Node returns a spec for a node of the given type with a single output
+func Node(nodeType string, properties map[string]interface{}) Spec {
+	return Spec{Type: nodeType, Properties: properties, Ports: 1}
+}
+
+// Inject returns an inject node that fires when triggered manually
+func Inject() Spec {
+	return Node("inject", map[string]interface{}{
+		"payload":     "",
+		"payloadType": "date",
+		"repeat":      "",
+		"once":        false,
+		"topic":       "",
+	})
+}
+
+// Function returns a function node running the given JavaScript
+func Function(code string) Spec {
+	return Node("function", map[string]interface{}{
+		"func":    code,
+		"outputs": 1,
+	})
+}
+
+// Debug returns a debug node logging msg.payload to the sidebar
+func Debug() Spec {
+	return Node("debug", map[string]interface{}{
+		"active":     true,
+		"tosidebar":  true,
+		"console":    false,
+		"complete":   "payload",
+		"targetType": "msg",
+	}).WithPorts(0)
+}
+
+// Instance returns a node instantiating a subflow, with env overriding the
+// subflow's property defaults. Add the template with Builder.Subflow unless
+// it is already deployed.
+func Instance(subflow types.SubflowDefinition, env ...types.EnvVar) Spec {
+	node := subflow.Instance("", env...)
+	return Node(node.Type, node.Properties).WithPorts(len(subflow.Out))
+}
+
+// ToNode implements NodeSpec
+func (s Spec) ToNode() (types.Node, error) {
+	properties := make(map[string]interface{}, len(s.Properties))
+	for key, value := range s.Properties {
+		properties[key] = value
+	}
+
+	return types.Node{
+		ID:         s.ID,
+		Type:       s.Type,
+		Name:       s.Name,
+		Position:   s.Position,
+		Properties: properties,
+	}, nil
+}
+
+// Outputs implements NodeSpec
+func (s Spec) Outputs() int {
+	return s.Ports
+}
+
+// Named returns a copy of the spec with the given name
+func (s Spec) Named(name string) Spec {
+	s.Name = name
+	return s
+}
+
+// WithID returns a copy of the spec with a fixed ID instead of a generated one
+func (s Spec) WithID(id string) Spec {
+	s.ID = id
+	return s
+}
+
+// At returns a copy of the spec placed at the given editor coordinates
+func (s Spec) At(x, y float64) Spec {
+	s.Position = types.Position{X: x, Y: y}
+	return s
+}
+
+// WithPorts returns a copy of the spec with the given number of outputs
+func (s Spec) WithPorts(ports int) Spec {
+	s.Ports = ports
+	if s.Type == "function" {
+		s = s.With("outputs", ports)
+	}
+	return s
+}
+
+// With returns a copy of the spec with a property set
+func (s Spec) With(key string, value interface{}) Spec {
+	properties := make(map[string]interface{}, len(s.Properties)+1)
+	for k, v := range s.Properties {
+		properties[k] = v
+	}
+	properties[key] = value
+	s.Properties = properties
+	return s
+}
+
+// Builder assembles a FlowDefinition. Errors, such as wiring an output port
+// a node does not have, are collected and reported by Build.
+type Builder struct {
+	flow    *types.FlowDefinition
+	index   map[string]int
+	outputs map[string]int
+	counter int
+	errs    []error
+}
+
+// New starts a flow (tab) with the given ID
+func New(id string) *Builder {
+	return &Builder{
+		flow: &types.FlowDefinition{
+			ID:    id,
+			Name:  id,
+			Nodes: []types.Node{},
+		},
+		index:   make(map[string]int),
+		outputs: make(map[string]int),
+	}
+}
+
+// Name sets the tab label
+func (b *Builder) Name(name string) *Builder {
+	b.flow.Name = name
+	return b
+}
+
+// Description sets the tab description
+func (b *Builder) Description(description string) *Builder {
+	b.flow.Description = description
+	return b
+}
+
+// Env sets tab environment variables, which the flow's nodes read as ${NAME}.
+// A variable already set with the same name is replaced.
+func (b *Builder) Env(vars ...types.EnvVar) *Builder {
+	for _, v := range vars {
+		b.flow.Env = setEnvVar(b.flow.Env, v)
+	}
+	return b
+}
+
+// Subflow adds a subflow template to the flow, so it is deployed along with
+// the instances created with Instance. Adding the same template twice has no
+// effect.
+func (b *Builder) Subflow(subflow types.SubflowDefinition) *Builder {
+	for _, existing := range b.flow.Subflows {
+		if existing.ID == subflow.ID {
+			return b
+		}
+	}
+	b.flow.Subflows = append(b.flow.Subflows, subflow)
+	return b
+}
+
+// Inject starts a chain with a manually triggered inject node
+func (b *Builder) Inject(name string) *Chain {
+	return b.Start(Inject().Named(name))
+}
+
+// Start adds a node that nothing is wired into and returns a chain from it
+func (b *Builder) Start(spec NodeSpec) *Chain {
+	id := b.add(spec)
+	return &Chain{builder: b, tails: []tail{{id: id, port: 0}}}
+}
+
+// Merge returns a chain whose next node receives the output of every given chain
+func (b *Builder) Merge(chains ...*Chain) *Chain {
+	merged := &Chain{builder: b}
+	for _, chain := range chains {
+		merged.tails = append(merged.tails, chain.tails...)
+	}
+	return merged
+}
+
+// Build returns the flow, or every error collected while building it
+func (b *Builder) Build() (*types.FlowDefinition, error) {
+	if b.flow.ID == "" {
+		b.errs = append(b.errs, fmt.Errorf("flow ID is required"))
+	}
+	if len(b.errs) > 0 {
+		return nil, errors.Join(b.errs...)
+	}
+	return b.flow, nil
+}
+
+// add appends the node to the flow with one empty wire list per output. A
+// node that fails to convert is still added, so that chaining can go on, and
+// the error is reported by Build.
+func (b *Builder) add(spec NodeSpec) string {
+	node, err := spec.ToNode()
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	if node.ID == "" {
+		node.ID = b.nextID()
+	}
+	if _, ok := b.index[node.ID]; ok {
+		b.errs = append(b.errs, fmt.Errorf("duplicate node ID %s", node.ID))
+	}
+
+	outputs := spec.Outputs()
+	node.Wires = make([][]string, outputs)
+	for i := range node.Wires {
+		node.Wires[i] = []string{}
+	}
+
+	b.index[node.ID] = len(b.flow.Nodes)
+	b.outputs[node.ID] = outputs
+	b.flow.Nodes = append(b.flow.Nodes, node)
+	return node.ID
+}
+
+// wire connects an output port of one node to another node
+func (b *Builder) wire(from tail, to string) {
+	outputs := b.outputs[from.id]
+	if from.port < 0 || from.port >= outputs {
+		b.errs = append(b.errs, fmt.Errorf("node %s has %d outputs, cannot wire output %d to %s", from.id, outputs, from.port, to))
+		return
+	}
+
+	node := &b.flow.Nodes[b.index[from.id]]
+	node.Wires[from.port] = append(node.Wires[from.port], to)
+}
+
+// nextID returns a 16 hex digit ID in the style of the Node-RED editor. IDs
+// are derived from the flow ID and the node's position in the build order, so
+// building the same flow again yields the same IDs and redeploys update nodes
+// in place instead of replacing them.
+func (b *Builder) nextID() string {
+	for {
+		b.counter++
+		sum := sha1.Sum([]byte(b.flow.ID + "/" + strconv.Itoa(b.counter)))
+		id := hex.EncodeToString(sum[:8])
+		if _, taken := b.index[id]; !taken {
+			return id
+		}
+	}
+}
+
+// tail is an output port the next node in a chain is wired from
+type tail struct {
+	id   string
+	port int
+}
+
+// Chain is a position in the flow that the next node is wired from
+type Chain struct {
+	builder *Builder
+	tails   []tail
+}
+
+// Then adds a node wired from the chain's current outputs and moves the chain
+// to the node's first output
+func (c *Chain) Then(spec NodeSpec) *Chain {
+	id := c.builder.add(spec)
+	for _, from := range c.tails {
+		c.builder.wire(from, id)
+	}
+	return &Chain{builder: c.builder, tails: []tail{{id: id, port: 0}}}
+}
+
+// Port returns the chain continuing from another output of the current nodes,
+// e.g. the second rule of a switch node is Port(1)
+func (c *Chain) Port(port int) *Chain {
+	tails := make([]tail, len(c.tails))
+	for i, t := range c.tails {
+		tails[i] = tail{id: t.id, port: port}
+	}
+	return &Chain{builder: c.builder, tails: tails}
+}
+
+// Branch continues each output of the current nodes in its own chain: the
+// first function receives output 0, the second output 1 and so on. The
+// original chain is returned so that building can continue from it.
+func (c *Chain) Branch(branches ...func(*Chain)) *Chain {
+	for port, branch := range branches {
+		if branch != nil {
+			branch(c.Port(port))
+		}
+	}
+	return c
+}
+
+// IDs returns the IDs of the nodes the chain currently ends in
+func (c *Chain) IDs() []string {
+	ids := make([]string, len(c.tails))
+	for i, t := range c.tails {
+		ids[i] = t.id
+	}
+	return ids
+}
+
+// Build returns the flow the chain belongs to
+func (c *Chain) Build() (*types.FlowDefinition, error) {
+	return c.builder.Build()
+}
@@ -0,0 +1,284 @@
+package flow
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+func TestBuilder_Chain(t *testing.T) {
+	def, err := New("orders").
+		Name("Orders").
+		Inject("Start").
+		Then(Function("return msg;").Named("Process")).
+		Then(Debug()).
+		Build()
+	require.NoError(t, err)
+
+	assert.Equal(t, "orders", def.ID)
+	assert.Equal(t, "Orders", def.Name)
+	require.Len(t, def.Nodes, 3)
+
+	inject, function, debug := def.Nodes[0], def.Nodes[1], def.Nodes[2]
+	assert.Equal(t, "inject", inject.Type)
+	assert.Equal(t, "Start", inject.Name)
+	assert.Equal(t, [][]string{{function.ID}}, inject.Wires)
+	assert.Equal(t, [][]string{{debug.ID}}, function.Wires)
+	assert.Equal(t, [][]string{}, debug.Wires)
+
+	idPattern := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	for _, node := range def.Nodes {
+		assert.Regexp(t, idPattern, node.ID)
+	}
+
+	again, err := New("orders").Inject("Start").Then(Function("return msg;")).Then(Debug()).Build()
+	require.NoError(t, err)
+	assert.Equal(t, inject.ID, again.Nodes[0].ID, "IDs should be stable across builds")
+}
+
+func TestBuilder_Branch(t *testing.T) {
+	b := New("routing")
+	sw := Node("switch", map[string]interface{}{"property": "payload"}).WithID("sw").WithPorts(2)
+
+	chain := b.Inject("Start").Then(sw)
+	var high, low *Chain
+	chain.Branch(
+		func(c *Chain) { high = c.Then(Debug().WithID("high")) },
+		func(c *Chain) { low = c.Then(Function("return msg;").WithID("low")) },
+	)
+	b.Merge(chain.Port(1), low).Then(Debug().WithID("both"))
+
+	def, err := b.Build()
+	require.NoError(t, err)
+	require.NotNil(t, high)
+
+	nodes := map[string][][]string{}
+	for _, node := range def.Nodes {
+		nodes[node.ID] = node.Wires
+	}
+	assert.Equal(t, [][]string{{"high"}, {"low", "both"}}, nodes["sw"])
+	assert.Equal(t, [][]string{{"both"}}, nodes["low"])
+	assert.Equal(t, "payload", def.Nodes[1].Properties["property"])
+	assert.Len(t, def.Nodes, 5)
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	_, err := New("broken").
+		Start(Debug().WithID("sink")).
+		Then(Function("return msg;")).
+		Build()
+	assert.ErrorContains(t, err, "node sink has 0 outputs")
+
+	b := New("dupes")
+	b.Start(Inject().WithID("a"))
+	b.Start(Inject().WithID("a"))
+	_, err = b.Build()
+	assert.ErrorContains(t, err, "duplicate node ID a")
+
+	_, err = New("").Inject("Start").Build()
+	assert.ErrorContains(t, err, "flow ID is required")
+}
+
+func TestValidate(t *testing.T) {
+	def := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "in", Type: "inject", Wires: [][]string{{"fn", "missing"}}},
+			{ID: "fn", Type: "function", Properties: map[string]interface{}{"outputs": 1}, Wires: [][]string{{"sw"}, {"dbg"}}},
+			{ID: "sw", Type: "switch", Properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"t": "else"}}, "outputs": 1}, Wires: [][]string{{"fn"}}},
+			{ID: "dbg", Type: "debug", Wires: [][]string{{"in"}}},
+			{ID: "dbg", Type: "debug"},
+			{ID: "web", Type: "http in", Properties: map[string]interface{}{"url": ""}},
+		},
+	}
+
+	problems := Validate(def)
+	codes := map[string][]string{}
+	for _, p := range problems {
+		codes[p.Code] = append(codes[p.Code], p.NodeID)
+	}
+
+	assert.Equal(t, []string{"dbg"}, codes[ProblemDuplicateID])
+	assert.Equal(t, []string{"in"}, codes[ProblemDanglingWire])
+	assert.ElementsMatch(t, []string{"fn", "dbg"}, codes[ProblemOutputCount])
+	assert.ElementsMatch(t, []string{"fn", "web"}, codes[ProblemMissingProperty])
+	assert.NotEmpty(t, codes[ProblemCycle])
+	for _, p := range problems.Warnings() {
+		assert.Equal(t, ProblemCycle, p.Code)
+	}
+
+	err := problems.Err()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, types.ErrInvalidFlow)
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Problems, len(problems.Errors()))
+
+	built, err := New("ok").Inject("Start").Then(Function("return msg;")).Then(Debug()).Build()
+	require.NoError(t, err)
+	assert.Empty(t, Validate(built))
+	assert.NoError(t, Validate(built).Err())
+
+	// Connections are checked as the wires they stand for
+	connected := &types.FlowDefinition{
+		ID:          "tab",
+		Nodes:       []types.Node{{ID: "a", Type: "inject", Wires: [][]string{{"b"}}}, {ID: "b", Type: "debug"}},
+		Connections: []types.Connection{{Source: "a", Target: "c"}, {Source: "b", Target: "a"}},
+	}
+	problems = Validate(connected)
+	require.Len(t, problems.Errors(), 2)
+	assert.Equal(t, ProblemConnection, problems[0].Code)
+	assert.Equal(t, "a", problems[0].NodeID)
+	assert.Equal(t, ProblemOutputCount, problems[1].Code)
+	assert.Equal(t, "b", problems[1].NodeID)
+
+	// Typed empty values are missing, and output counts may be strings or
+	// json.Number
+	typed := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "sw", Type: "switch", Properties: map[string]interface{}{"rules": []map[string]interface{}{}, "outputs": "1"}, Wires: [][]string{{"dbg"}, {"dbg"}}},
+			{ID: "fn", Type: "function", Properties: map[string]interface{}{"func": "return msg;", "outputs": json.Number("1")}, Wires: [][]string{{}, {"dbg"}}},
+			{ID: "mqtt", Type: "mqtt out", Properties: map[string]interface{}{"broker": []string{}}},
+			{ID: "dbg", Type: "debug"},
+		},
+	}
+	codes = map[string][]string{}
+	for _, p := range Validate(typed) {
+		codes[p.Code] = append(codes[p.Code], p.NodeID)
+	}
+	assert.ElementsMatch(t, []string{"sw", "mqtt"}, codes[ProblemMissingProperty])
+	assert.ElementsMatch(t, []string{"sw", "fn"}, codes[ProblemOutputCount])
+
+	// Subflow nodes get the same checks, with wires kept inside the subflow
+	typed.Nodes = []types.Node{{ID: "dbg", Type: "debug"}}
+	typed.Subflows = []types.SubflowDefinition{{
+		ID: "sf",
+		Nodes: []types.Node{
+			{ID: "sf-fn", Type: "function", Properties: map[string]interface{}{"outputs": 1}, Wires: [][]string{{"dbg"}, {"sf-dbg"}}},
+			{ID: "sf-dbg"},
+		},
+	}}
+	codes = map[string][]string{}
+	for _, p := range Validate(typed) {
+		codes[p.Code] = append(codes[p.Code], p.NodeID)
+	}
+	assert.Equal(t, []string{"sf-fn"}, codes[ProblemDanglingWire])
+	assert.Equal(t, []string{"sf-fn"}, codes[ProblemOutputCount])
+	assert.Equal(t, []string{"sf-fn"}, codes[ProblemMissingProperty])
+	assert.Equal(t, []string{"sf-dbg"}, codes[ProblemMissingType])
+}
+
+func TestBuilder_Subflow(t *testing.T) {
+	clean := types.SubflowDefinition{
+		ID:    "clean",
+		Name:  "Clean",
+		In:    []types.SubflowPort{{Wires: []types.SubflowWire{{ID: "clean-fn"}}}},
+		Out:   []types.SubflowPort{{Wires: []types.SubflowWire{{ID: "clean-fn"}}}, {Wires: []types.SubflowWire{{ID: "clean-fn", Port: 1}}}},
+		Env:   []types.EnvVar{{Name: "LEVEL", Value: "1", Type: "num"}},
+		Nodes: []types.Node{{ID: "clean-fn", Type: "function", Properties: map[string]interface{}{"func": "return [msg, null];", "outputs": 2}}},
+	}
+
+	b := New("tab").Subflow(clean).Subflow(clean)
+	chain := b.Inject("Start").Then(Instance(clean, types.EnvVar{Name: "LEVEL", Value: "3", Type: "num"}).WithID("inst"))
+	chain.Port(1).Then(Debug().WithID("errors"))
+	def, err := b.Build()
+	require.NoError(t, err)
+
+	require.Len(t, def.Subflows, 1)
+	inst := def.Nodes[1]
+	assert.Equal(t, "subflow:clean", inst.Type)
+	assert.Equal(t, []types.EnvVar{{Name: "LEVEL", Value: "3", Type: "num"}}, inst.Properties["env"])
+	assert.Equal(t, [][]string{{}, {"errors"}}, inst.Wires)
+	assert.Empty(t, Validate(def))
+
+	// An instance wired past the template's outputs, and one of an unknown
+	// subflow
+	def.Nodes[1].Wires = append(def.Nodes[1].Wires, []string{"errors"})
+	def.Nodes = append(def.Nodes, types.Node{ID: "other", Type: "subflow:missing"})
+	def.Subflows = append(def.Subflows, types.SubflowDefinition{ID: "dup", Nodes: []types.Node{{ID: "errors", Type: "debug"}}})
+	codes := map[string][]string{}
+	for _, p := range Validate(def) {
+		codes[p.Code] = append(codes[p.Code], p.NodeID)
+	}
+	assert.Equal(t, []string{"inst"}, codes[ProblemOutputCount])
+	assert.Equal(t, []string{"other"}, codes[ProblemUnknownSubflow])
+	assert.Equal(t, []string{"errors"}, codes[ProblemDuplicateID])
+
+	// Templates come before the subflows instantiating them
+	outer := types.SubflowDefinition{ID: "outer", Nodes: []types.Node{clean.Instance("outer-inst")}}
+	ordered := types.OrderSubflows([]types.SubflowDefinition{outer, clean})
+	assert.Equal(t, "clean", ordered[0].ID)
+	assert.Equal(t, "outer", ordered[1].ID)
+}
+
+func TestTemplate(t *testing.T) {
+	b := New("orders").Env(types.EnvVar{Name: "BATCH_SIZE", Value: "10", Type: types.EnvNumber})
+	b.Start(Node("mqtt in", map[string]interface{}{"topic": "${TENANT}/orders", "broker": "broker"}).WithID("in")).
+		Then(Debug().WithID("log"))
+	def, err := b.Build()
+	require.NoError(t, err)
+	def.Configs = []types.Node{{ID: "broker", Type: "mqtt-broker"}}
+	assert.Empty(t, Validate(def))
+
+	tmpl := &Template{Flow: def, Params: []Param{
+		{Name: "TENANT", Required: true},
+		{Name: "BATCH_SIZE", Type: types.EnvNumber},
+		{Name: "DEBUG", Type: types.EnvBool, Default: "false"},
+		{Name: "API_TOKEN", Type: types.EnvCredential},
+	}}
+
+	acme, err := tmpl.Instantiate("orders-acme", map[string]string{"TENANT": "acme", "API_TOKEN": "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "orders-acme", acme.ID)
+	assert.Equal(t, []types.EnvVar{
+		{Name: "BATCH_SIZE", Value: "10", Type: types.EnvNumber},
+		{Name: "TENANT", Value: "acme", Type: types.EnvString},
+		{Name: "DEBUG", Value: "false", Type: types.EnvBool},
+		{Name: "API_TOKEN", Value: "secret", Type: types.EnvCredential},
+	}, acme.Env)
+	assert.Empty(t, Validate(acme))
+
+	// Node IDs differ per instance, and references follow
+	in, log, broker := acme.Nodes[0].ID, acme.Nodes[1].ID, acme.Configs[0].ID
+	assert.NotContains(t, []string{in, log, broker}, "in")
+	assert.Equal(t, [][]string{{log}}, acme.Nodes[0].Wires)
+	assert.Equal(t, broker, acme.Nodes[0].Properties["broker"])
+	assert.Equal(t, "in", def.Nodes[0].ID, "the template is not modified")
+	assert.Equal(t, "broker", def.Nodes[0].Properties["broker"])
+
+	again, err := tmpl.Instantiate("orders-acme", map[string]string{"TENANT": "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, in, again.Nodes[0].ID)
+	globex, err := tmpl.Instantiate("orders-globex", map[string]string{"TENANT": "globex", "BATCH_SIZE": "50"})
+	require.NoError(t, err)
+	assert.NotEqual(t, in, globex.Nodes[0].ID)
+	assert.Equal(t, "50", globex.Env[0].Value)
+
+	_, err = tmpl.Instantiate("orders-bad", map[string]string{"BATCH_SIZE": "many", "REGION": "eu"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "param TENANT is required")
+	assert.Contains(t, err.Error(), `"many" is not a number`)
+	assert.Contains(t, err.Error(), "param REGION is not declared")
+
+	// Tab env vars are checked by Validate
+	def.Env = append(def.Env,
+		types.EnvVar{Name: "BATCH_SIZE", Value: "1", Type: types.EnvNumber},
+		types.EnvVar{Name: "ON", Value: "yes", Type: types.EnvBool},
+		types.EnvVar{Name: "EXPR", Value: "1+1", Type: "jsonata"},
+	)
+	var problems []string
+	for _, p := range Validate(def) {
+		problems = append(problems, string(p.Severity)+" "+p.Message)
+	}
+	assert.Equal(t, []string{
+		"error env var BATCH_SIZE is defined more than once",
+		`error env var ON: "yes" is not true or false`,
+		`warning env var EXPR has unknown type "jsonata"`,
+	}, problems)
+}
@@ -0,0 +1,190 @@
+package flow
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// Param is a variable a Template is instantiated with. Each instance gets it
+// as a tab env var, which the template's nodes read as ${NAME}.
+type Param struct {
+	Name string        `json:"name"`
+	Type types.EnvType `json:"type,omitempty"` // Defaults to types.EnvString
+	// Required params must be given a value, unless they have a Default
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Template is a flow deployed once per tenant or environment, each time with
+// its own parameter values:
+//
+//	tmpl := &flow.Template{Flow: def, Params: []flow.Param{
+//		{Name: "TENANT", Required: true},
+//		{Name: "BATCH_SIZE", Type: types.EnvNumber, Default: "100"},
+//	}}
+//	acme, err := tmpl.Instantiate("orders-acme", map[string]string{"TENANT": "acme"})
+type Template struct {
+	Flow   *types.FlowDefinition `json:"flow"`
+	Params []Param               `json:"params"`
+}
+
+// Instantiate returns the flow of one instance of the template, with the
+// given ID and the values set as tab env vars. Node-RED needs node IDs to be
+// unique across tabs, so the IDs of the flow's nodes and config nodes are
+// derived from the instance ID, and wires, connections and properties
+// referring to them follow; instantiating again yields the same IDs. Subflow
+// templates are shared by all instances and keep their IDs. Missing required
+// values, values for undeclared params and values unsuited to their type are
+// reported together.
+func (t *Template) Instantiate(id string, values map[string]string) (*types.FlowDefinition, error) {
+	if t.Flow == nil {
+		return nil, fmt.Errorf("template has no flow")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("flow ID is required")
+	}
+
+	var errs []error
+	declared := make(map[string]bool, len(t.Params))
+	env := append([]types.EnvVar(nil), t.Flow.Env...)
+	for _, param := range t.Params {
+		declared[param.Name] = true
+		value, given := values[param.Name]
+		if !given {
+			value, given = param.Default, param.Default != ""
+		}
+		if param.Required && value == "" {
+			errs = append(errs, fmt.Errorf("param %s is required", param.Name))
+			continue
+		}
+		if !given {
+			continue
+		}
+
+		v := types.EnvVar{Name: param.Name, Value: value, Type: param.Type}
+		if v.Type == "" {
+			v.Type = types.EnvString
+		}
+		if err := v.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		env = setEnvVar(env, v)
+	}
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Errorf("param %s is not declared", name))
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("flow %s: %w", id, errors.Join(errs...))
+	}
+
+	ids := make(map[string]string, len(t.Flow.Nodes)+len(t.Flow.Configs))
+	for _, node := range append(append([]types.Node(nil), t.Flow.Nodes...), t.Flow.Configs...) {
+		sum := sha1.Sum([]byte(id + "/" + node.ID))
+		ids[node.ID] = hex.EncodeToString(sum[:8])
+	}
+
+	instance := *t.Flow
+	instance.ID = id
+	instance.Env = env
+	instance.Nodes = renameNodes(t.Flow.Nodes, ids)
+	instance.Configs = renameNodes(t.Flow.Configs, ids)
+	instance.Connections = make([]types.Connection, len(t.Flow.Connections))
+	for i, c := range t.Flow.Connections {
+		c.Source, c.Target = rename(c.Source, ids), rename(c.Target, ids)
+		instance.Connections[i] = c
+	}
+	if t.Flow.Connections == nil {
+		instance.Connections = nil
+	}
+	return &instance, nil
+}
+
+// setEnvVar replaces the variable with the same name, or appends it
+func setEnvVar(env []types.EnvVar, v types.EnvVar) []types.EnvVar {
+	for i := range env {
+		if env[i].Name == v.Name {
+			env[i] = v
+			return env
+		}
+	}
+	return append(env, v)
+}
+
+// renameNodes returns copies of the nodes with their IDs, wires and
+// properties renamed
+func renameNodes(nodes []types.Node, ids map[string]string) []types.Node {
+	if nodes == nil {
+		return nil
+	}
+	renamed := make([]types.Node, len(nodes))
+	for i, node := range nodes {
+		node.ID = rename(node.ID, ids)
+		if node.Wires != nil {
+			wires := make([][]string, len(node.Wires))
+			for port, targets := range node.Wires {
+				wires[port] = renameValue(targets, ids).([]string)
+			}
+			node.Wires = wires
+		}
+		if node.Properties != nil {
+			node.Properties = renameValue(node.Properties, ids).(map[string]interface{})
+		}
+		renamed[i] = node
+	}
+	return renamed
+}
+
+// renameValue deep-copies a property value, renaming every string that is
+// the ID of a renamed node, such as a config node reference or the targets
+// of a link node
+func renameValue(value interface{}, ids map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return rename(v, ids)
+	case []string:
+		if v == nil {
+			return v
+		}
+		renamed := make([]string, len(v))
+		for i, item := range v {
+			renamed[i] = rename(item, ids)
+		}
+		return renamed
+	case []interface{}:
+		renamed := make([]interface{}, len(v))
+		for i, item := range v {
+			renamed[i] = renameValue(item, ids)
+		}
+		return renamed
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			renamed[key] = renameValue(item, ids)
+		}
+		return renamed
+	default:
+		return value
+	}
+}
+
+// rename returns the new ID of a renamed node, or id unchanged
+func rename(id string, ids map[string]string) string {
+	if renamed, ok := ids[id]; ok {
+		return renamed
+	}
+	return id
+}
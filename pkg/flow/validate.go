@@ -0,0 +1,353 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/graph"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// Severity tells whether a problem stops a flow from being deployed
+type Severity string
+
+const (
+	// SeverityError marks a flow Node-RED would reject or run incorrectly
+	SeverityError Severity = "error"
+	// SeverityWarning marks a flow that deploys but is probably not intended
+	SeverityWarning Severity = "warning"
+)
+
+// Problem codes reported by Validate
+const (
+	ProblemMissingID       = "missing_id"
+	ProblemMissingType     = "missing_type"
+	ProblemDuplicateID     = "duplicate_id"
+	ProblemDanglingWire    = "dangling_wire"
+	ProblemOutputCount     = "output_count"
+	ProblemMissingProperty = "missing_property"
+	ProblemCycle           = "cycle"
+	ProblemConnection      = "connection_conflict"
+	ProblemUnknownSubflow  = "unknown_subflow"
+	ProblemMissingConfig   = "missing_config"
+	ProblemInvalidEnv      = "invalid_env"
+)
+
+// Problem is an issue found in a flow by Validate
+type Problem struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	// NodeID is the node the problem was found on, empty for the flow itself
+	NodeID  string `json:"node_id,omitempty"`
+	Message string `json:"message"`
+}
+
+// String renders the problem for logs and error messages
+func (p Problem) String() string {
+	if p.NodeID == "" {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: node %s: %s", p.Severity, p.NodeID, p.Message)
+}
+
+// Problems is the result of Validate
+type Problems []Problem
+
+// Errors returns the problems of error severity
+func (p Problems) Errors() Problems {
+	return p.filter(SeverityError)
+}
+
+// Warnings returns the problems of warning severity
+func (p Problems) Warnings() Problems {
+	return p.filter(SeverityWarning)
+}
+
+func (p Problems) filter(severity Severity) Problems {
+	var filtered Problems
+	for _, problem := range p {
+		if problem.Severity == severity {
+			filtered = append(filtered, problem)
+		}
+	}
+	return filtered
+}
+
+// Err returns a *ValidationError holding the errors, or nil when there are
+// none. Warnings alone never make a flow invalid.
+func (p Problems) Err() error {
+	errs := p.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: errs}
+}
+
+// ValidationError is returned when a flow has errors. It matches
+// types.ErrInvalidFlow with errors.Is.
+type ValidationError struct {
+	Problems Problems
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.String()
+	}
+	return fmt.Sprintf("%s: %s", types.ErrInvalidFlow, strings.Join(messages, "; "))
+}
+
+// Unwrap makes errors.Is(err, types.ErrInvalidFlow) hold
+func (e *ValidationError) Unwrap() error {
+	return types.ErrInvalidFlow
+}
+
+// fixedOutputs are the output counts of core nodes that do not take them from
+// an "outputs" property
+var fixedOutputs = map[string]int{
+	"inject":        1,
+	"debug":         0,
+	"catch":         1,
+	"status":        1,
+	"complete":      1,
+	"link in":       1,
+	"link out":      0,
+	"link call":     1,
+	"change":        1,
+	"template":      1,
+	"http in":       1,
+	"http response": 0,
+	"http request":  1,
+	"mqtt in":       1,
+	"mqtt out":      0,
+	"split":         1,
+	"join":          1,
+	"comment":       0,
+}
+
+// requiredProperties are properties a core node does nothing useful without
+var requiredProperties = map[string][]string{
+	"function": {"func"},
+	"switch":   {"rules"},
+	"change":   {"rules"},
+	"http in":  {"url"},
+	"mqtt in":  {"broker"},
+	"mqtt out": {"broker"},
+}
+
+// Validate checks a flow for problems that would make Node-RED reject it or
+// run it differently than intended: missing or duplicate IDs, wires to nodes
+// that do not exist, wires from outputs a node does not have and missing
+// required properties are errors, for the nodes of the flow and of its
+// subflows alike, whose wires must stay inside the subflow; cycles are
+// warnings, since loops are sometimes deliberate, and so are instances of subflows the flow does not
+// carry, which must already be deployed. Nodes referring to a config node
+// (see types.ConfigProperties) that is neither in the flow's Configs nor among
+// the global config nodes given are errors. Env vars with an invalid name, a
+// value unsuited to their type or a name used twice are errors, and env vars
+// of unknown types are warnings. Wiring given only as Connections is checked
+// as the wires it translates to, and Connections that disagree with Wires are
+// errors.
+func Validate(flow *types.FlowDefinition, globals ...types.Node) Problems {
+	if flow == nil {
+		return Problems{{Severity: SeverityError, Code: ProblemMissingID, Message: "flow is nil"}}
+	}
+
+	var problems Problems
+	flow, err := flow.Reconciled()
+	var conflict *types.ConnectionConflictError
+	if errors.As(err, &conflict) {
+		for _, c := range conflict.Conflicts {
+			problems = append(problems, Problem{Severity: SeverityError, Code: ProblemConnection, NodeID: c.NodeID, Message: c.Reason})
+		}
+	}
+
+	report := func(severity Severity, code, nodeID, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Severity: severity,
+			Code:     code,
+			NodeID:   nodeID,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if flow.ID == "" {
+		report(SeverityError, ProblemMissingID, "", "flow ID is required")
+	}
+
+	seen := map[string]bool{flow.ID: flow.ID != ""}
+	checkID := func(node types.Node, i int) {
+		if node.ID == "" {
+			report(SeverityError, ProblemMissingID, "", "node %d (%s) has no ID", i, node.Type)
+			return
+		}
+		if seen[node.ID] {
+			report(SeverityError, ProblemDuplicateID, node.ID, "ID is used more than once")
+		}
+		seen[node.ID] = true
+	}
+
+	for i, node := range flow.Configs {
+		checkID(node, i)
+	}
+
+	subflows := make(map[string]types.SubflowDefinition, len(flow.Subflows))
+	for _, subflow := range flow.Subflows {
+		checkID(types.Node{ID: subflow.ID, Type: "subflow"}, 0)
+		for i, node := range append(append([]types.Node(nil), subflow.Nodes...), subflow.Configs...) {
+			checkID(node, i)
+		}
+		subflows[subflow.ID] = subflow
+	}
+
+	for i, node := range flow.Nodes {
+		checkID(node, i)
+	}
+
+	// checkNodes checks the nodes of the flow or of one of its subflows,
+	// whose wires may only lead to nodes of the same scope
+	checkNodes := func(members []types.Node, scope string) {
+		ids := make(map[string]bool, len(members))
+		for _, node := range members {
+			ids[node.ID] = true
+		}
+
+		for _, node := range members {
+			if node.Type == "" {
+				report(SeverityError, ProblemMissingType, node.ID, "node has no type")
+			}
+
+			for port, targets := range node.Wires {
+				for _, target := range targets {
+					if !ids[target] {
+						report(SeverityError, ProblemDanglingWire, node.ID, "output %d is wired to %s, which is not in %s", port, target, scope)
+					}
+				}
+			}
+
+			subflowID, isInstance := types.SubflowID(node)
+			subflow, known := subflows[subflowID]
+			if isInstance && !known {
+				report(SeverityWarning, ProblemUnknownSubflow, node.ID, "subflow %s is not part of the flow and must already be deployed", subflowID)
+			}
+
+			outputs, ok := expectedOutputs(node)
+			if known {
+				outputs, ok = len(subflow.Out), true
+			}
+			if ok {
+				for port := outputs; port < len(node.Wires); port++ {
+					if len(node.Wires[port]) > 0 {
+						report(SeverityError, ProblemOutputCount, node.ID, "%s node has %d outputs but output %d is wired", node.Type, outputs, port)
+						break
+					}
+				}
+			}
+
+			for _, property := range requiredProperties[node.Type] {
+				if isEmpty(node.Properties[property]) {
+					report(SeverityError, ProblemMissingProperty, node.ID, "%s node requires %q", node.Type, property)
+				}
+			}
+		}
+	}
+	checkNodes(flow.Nodes, "the flow")
+	for _, subflow := range flow.Subflows {
+		checkNodes(subflow.Nodes, "subflow "+subflow.ID)
+	}
+
+	configs := make(map[string]bool, len(flow.Configs)+len(globals))
+	for _, config := range append(append([]types.Node(nil), flow.Configs...), globals...) {
+		configs[config.ID] = true
+	}
+	users := append(append([]types.Node(nil), flow.Nodes...), flow.Configs...)
+	for _, subflow := range flow.Subflows {
+		for _, config := range subflow.Configs {
+			configs[config.ID] = true
+		}
+		users = append(append(users, subflow.Nodes...), subflow.Configs...)
+	}
+	for _, node := range users {
+		for _, ref := range types.ConfigReferences(node) {
+			if !configs[ref.ConfigID] {
+				report(SeverityError, ProblemMissingConfig, node.ID, "%s refers to config node %s, which does not exist", ref.Property, ref.ConfigID)
+			}
+		}
+	}
+
+	checkEnv := func(owner string, env []types.EnvVar) {
+		names := make(map[string]bool, len(env))
+		for _, v := range env {
+			if names[v.Name] {
+				report(SeverityError, ProblemInvalidEnv, owner, "env var %s is defined more than once", v.Name)
+			}
+			names[v.Name] = true
+			if !v.Type.Known() {
+				report(SeverityWarning, ProblemInvalidEnv, owner, "env var %s has unknown type %q", v.Name, v.Type)
+			} else if err := v.Validate(); err != nil {
+				report(SeverityError, ProblemInvalidEnv, owner, "%v", err)
+			}
+		}
+	}
+	checkEnv("", flow.Env)
+	for _, subflow := range flow.Subflows {
+		checkEnv(subflow.ID, subflow.Env)
+	}
+
+	for _, cycle := range graph.FromNodes(flow.Nodes).Cycles() {
+		report(SeverityWarning, ProblemCycle, cycle[0], "nodes form a loop: %s", strings.Join(append(cycle, cycle[0]), " -> "))
+	}
+
+	return problems
+}
+
+// expectedOutputs returns how many outputs a node has, when that is known
+// from its type or its "outputs" property. The editor stores the property as
+// a number, but imported flows sometimes carry it as a string.
+func expectedOutputs(node types.Node) (int, bool) {
+	if value, ok := node.Properties["outputs"]; ok {
+		switch v := value.(type) {
+		case int:
+			return v, true
+		case int64:
+			return int(v), true
+		case float64:
+			return int(v), true
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return int(n), true
+			}
+		case string:
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return n, true
+			}
+		}
+	}
+	outputs, ok := fixedOutputs[node.Type]
+	return outputs, ok
+}
+
+// isEmpty reports whether a required property is missing or blank. Slices
+// and maps of any element type are blank when they have no elements.
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if s, ok := value.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,397 @@
+// Package graph analyzes the wiring of flows: what a node feeds into, which
+// nodes no entry point reaches, loops, topological order and paths between
+// nodes. Link nodes are resolved into virtual edges, so a message crossing a
+// link out / link in pair, or a link call and its return, is followed like a
+// wire.
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// ErrCycle is returned by TopologicalOrder for graphs containing a loop
+var ErrCycle = errors.New("graph contains a cycle")
+
+// EntryTypes are the node types that start messages on their own. Besides
+// inject, http in and mqtt in, this covers the catch, status and complete
+// nodes, which are triggered by events rather than wires.
+var EntryTypes = map[string]bool{
+	"inject":   true,
+	"http in":  true,
+	"mqtt in":  true,
+	"catch":    true,
+	"status":   true,
+	"complete": true,
+}
+
+// Edge is a connection from an output port of one node to another node
+type Edge struct {
+	From string
+	To   string
+	Port int
+	// Virtual edges come from link nodes rather than wires
+	Virtual bool
+}
+
+// Graph is the wiring of one or more flows. Build it with New; it is not
+// updated when the flows change.
+type Graph struct {
+	order []string
+	nodes map[string]types.Node
+	out   map[string][]Edge
+	in    map[string][]Edge
+}
+
+// New builds the graph of the nodes of the given flows. Pass every flow of an
+// instance to follow link nodes across tabs. Wiring given only as Connections
+// is taken into account; wires to nodes outside the flows are ignored.
+func New(flows ...*types.FlowDefinition) *Graph {
+	var nodes []types.Node
+	for _, flow := range flows {
+		if flow == nil {
+			continue
+		}
+		// Conflicting wiring is reported by flow.Validate; the wires win here
+		reconciled, _ := flow.Reconciled()
+		nodes = append(nodes, reconciled.Nodes...)
+	}
+	return FromNodes(nodes)
+}
+
+// FromNodes builds the graph of a list of nodes
+func FromNodes(nodes []types.Node) *Graph {
+	g := &Graph{
+		nodes: make(map[string]types.Node, len(nodes)),
+		out:   make(map[string][]Edge),
+		in:    make(map[string][]Edge),
+	}
+
+	for _, node := range nodes {
+		if _, ok := g.nodes[node.ID]; ok {
+			continue
+		}
+		g.order = append(g.order, node.ID)
+		g.nodes[node.ID] = node
+	}
+
+	for _, id := range g.order {
+		for port, targets := range g.nodes[id].Wires {
+			for _, target := range targets {
+				g.addEdge(Edge{From: id, To: target, Port: port})
+			}
+		}
+	}
+
+	g.resolveLinks()
+	return g
+}
+
+// addEdge records an edge between two nodes of the graph, once
+func (g *Graph) addEdge(edge Edge) {
+	if _, ok := g.nodes[edge.To]; !ok {
+		return
+	}
+	for _, existing := range g.out[edge.From] {
+		if existing == edge {
+			return
+		}
+	}
+	g.out[edge.From] = append(g.out[edge.From], edge)
+	g.in[edge.To] = append(g.in[edge.To], edge)
+}
+
+// Node returns the node with the given ID
+func (g *Graph) Node(id string) (types.Node, bool) {
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+// Nodes returns the IDs of all nodes, in the order they were given
+func (g *Graph) Nodes() []string {
+	return append([]string(nil), g.order...)
+}
+
+// Out returns the edges leaving a node
+func (g *Graph) Out(id string) []Edge {
+	return append([]Edge(nil), g.out[id]...)
+}
+
+// In returns the edges entering a node
+func (g *Graph) In(id string) []Edge {
+	return append([]Edge(nil), g.in[id]...)
+}
+
+// Successors returns the nodes a node sends messages to directly
+func (g *Graph) Successors(id string) []string {
+	return unique(g.out[id], func(e Edge) string { return e.To })
+}
+
+// Predecessors returns the nodes sending messages to a node directly
+func (g *Graph) Predecessors(id string) []string {
+	return unique(g.in[id], func(e Edge) string { return e.From })
+}
+
+// EntryNodes returns the nodes whose type is one of EntryTypes
+func (g *Graph) EntryNodes() []string {
+	var entries []string
+	for _, id := range g.order {
+		if EntryTypes[g.nodes[id].Type] {
+			entries = append(entries, id)
+		}
+	}
+	return entries
+}
+
+// Reachable returns the given nodes and every node a message from them can
+// reach, in breadth-first order
+func (g *Graph) Reachable(from ...string) []string {
+	seen := make(map[string]bool)
+	var reached, queue []string
+	for _, id := range from {
+		if _, ok := g.nodes[id]; ok && !seen[id] {
+			seen[id] = true
+			queue = append(queue, id)
+		}
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		reached = append(reached, id)
+		for _, next := range g.Successors(id) {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return reached
+}
+
+// Unreachable returns the nodes no message from an entry node can reach.
+// Comment nodes, which never handle messages, are left out.
+func (g *Graph) Unreachable() []string {
+	reached := make(map[string]bool)
+	for _, id := range g.Reachable(g.EntryNodes()...) {
+		reached[id] = true
+	}
+
+	var unreachable []string
+	for _, id := range g.order {
+		if !reached[id] && g.nodes[id].Type != "comment" {
+			unreachable = append(unreachable, id)
+		}
+	}
+	return unreachable
+}
+
+// StronglyConnectedComponents returns the groups of nodes that can all reach
+// each other, including single nodes. Components are listed in reverse
+// topological order and their members sorted by ID.
+func (g *Graph) StronglyConnectedComponents() [][]string {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+	next := 0
+
+	var connect func(id string)
+	connect = func(id string) {
+		index[id] = next
+		lowlink[id] = next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, succ := range g.Successors(id) {
+			if _, visited := index[succ]; !visited {
+				connect(succ)
+				lowlink[id] = min(lowlink[id], lowlink[succ])
+			} else if onStack[succ] {
+				lowlink[id] = min(lowlink[id], index[succ])
+			}
+		}
+
+		if lowlink[id] == index[id] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == id {
+					break
+				}
+			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+
+	for _, id := range g.order {
+		if _, visited := index[id]; !visited {
+			connect(id)
+		}
+	}
+	return components
+}
+
+// Cycles returns one loop for every group of nodes that feed back into each
+// other, as the node IDs along the loop starting with the smallest ID
+func (g *Graph) Cycles() [][]string {
+	var cycles [][]string
+	for _, component := range g.StronglyConnectedComponents() {
+		if len(component) == 1 && !g.hasEdge(component[0], component[0]) {
+			continue
+		}
+		cycles = append(cycles, g.cycleWithin(component))
+	}
+
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// cycleWithin finds a loop through the first node of a strongly connected
+// component, staying inside the component
+func (g *Graph) cycleWithin(component []string) []string {
+	members := make(map[string]bool, len(component))
+	for _, id := range component {
+		members[id] = true
+	}
+	start := component[0]
+
+	// Breadth-first search back to the start gives the shortest loop
+	parent := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range g.Successors(id) {
+			if !members[next] {
+				continue
+			}
+			if next == start {
+				cycle := []string{id}
+				for cycle[0] != start {
+					cycle = append([]string{parent[cycle[0]]}, cycle...)
+				}
+				return cycle
+			}
+			if _, seen := parent[next]; !seen {
+				parent[next] = id
+				queue = append(queue, next)
+			}
+		}
+	}
+	return component
+}
+
+// hasEdge reports whether from sends messages to to directly
+func (g *Graph) hasEdge(from, to string) bool {
+	for _, edge := range g.out[from] {
+		if edge.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TopologicalOrder returns the nodes ordered so that every node comes after
+// the nodes sending messages to it, keeping the given order where the wiring
+// allows. Graphs with loops have no such order and return ErrCycle.
+func (g *Graph) TopologicalOrder() ([]string, error) {
+	indegree := make(map[string]int, len(g.order))
+	for _, id := range g.order {
+		indegree[id] = len(g.Predecessors(id))
+	}
+
+	var ready, order []string
+	for _, id := range g.order {
+		if indegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	position := make(map[string]int, len(g.order))
+	for i, id := range g.order {
+		position[id] = i
+	}
+
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+
+		for _, next := range g.Successors(id) {
+			indegree[next]--
+			if indegree[next] == 0 {
+				ready = append(ready, next)
+				sort.SliceStable(ready, func(i, j int) bool { return position[ready[i]] < position[ready[j]] })
+			}
+		}
+	}
+
+	if len(order) < len(g.order) {
+		cycles := g.Cycles()
+		return nil, fmt.Errorf("%w: %v", ErrCycle, cycles[0])
+	}
+	return order, nil
+}
+
+// Paths returns the simple paths from one node to another, each listing the
+// node IDs from start to end. The number of paths grows quickly with the
+// number of branches, so at most limit paths are returned when limit > 0.
+func (g *Graph) Paths(from, to string, limit int) [][]string {
+	if _, ok := g.nodes[from]; !ok {
+		return nil
+	}
+	if _, ok := g.nodes[to]; !ok {
+		return nil
+	}
+
+	var paths [][]string
+	onPath := map[string]bool{}
+	var path []string
+
+	var walk func(id string) bool
+	walk = func(id string) bool {
+		path = append(path, id)
+		onPath[id] = true
+		defer func() {
+			path = path[:len(path)-1]
+			onPath[id] = false
+		}()
+
+		if id == to {
+			paths = append(paths, append([]string(nil), path...))
+			return limit > 0 && len(paths) >= limit
+		}
+		for _, next := range g.Successors(id) {
+			if !onPath[next] && walk(next) {
+				return true
+			}
+		}
+		return false
+	}
+
+	walk(from)
+	return paths
+}
+
+// unique maps edges to node IDs, dropping repeats
+func unique(edges []Edge, id func(Edge) string) []string {
+	var ids []string
+	seen := make(map[string]bool, len(edges))
+	for _, edge := range edges {
+		if v := id(edge); !seen[v] {
+			seen[v] = true
+			ids = append(ids, v)
+		}
+	}
+	return ids
+}
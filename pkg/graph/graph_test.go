@@ -0,0 +1,119 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// testFlow wires inject -> switch, whose outputs go to a and b, which both
+// feed join -> debug. orphan is wired to nothing and nothing is wired to it.
+func testFlow() *types.FlowDefinition {
+	return &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "inject", Type: "inject", Wires: [][]string{{"switch"}}},
+			{ID: "switch", Type: "switch", Wires: [][]string{{"a"}, {"b"}}},
+			{ID: "a", Type: "change", Wires: [][]string{{"join"}}},
+			{ID: "b", Type: "change", Wires: [][]string{{"join"}}},
+			{ID: "join", Type: "join", Wires: [][]string{{"debug"}}},
+			{ID: "debug", Type: "debug"},
+			{ID: "orphan", Type: "function", Wires: [][]string{{"missing"}}},
+			{ID: "note", Type: "comment"},
+		},
+	}
+}
+
+func TestGraph_Neighbours(t *testing.T) {
+	g := New(testFlow())
+
+	assert.Equal(t, []string{"a", "b"}, g.Successors("switch"))
+	assert.Equal(t, []string{"a", "b"}, g.Predecessors("join"))
+	assert.Empty(t, g.Successors("orphan"), "wires to unknown nodes are ignored")
+	assert.Equal(t, []Edge{{From: "switch", To: "b", Port: 1}}, g.Out("switch")[1:])
+	assert.Equal(t, []string{"inject"}, g.EntryNodes())
+}
+
+func TestGraph_Reachability(t *testing.T) {
+	g := New(testFlow())
+
+	assert.Equal(t, []string{"switch", "a", "b", "join", "debug"}, g.Reachable("switch"))
+	assert.Equal(t, []string{"orphan"}, g.Unreachable())
+}
+
+func TestGraph_Order(t *testing.T) {
+	g := New(testFlow())
+
+	order, err := g.TopologicalOrder()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"inject", "switch", "a", "b", "join", "debug", "orphan", "note"}, order)
+	assert.Empty(t, g.Cycles())
+
+	paths := g.Paths("inject", "debug", 0)
+	assert.Equal(t, [][]string{
+		{"inject", "switch", "a", "join", "debug"},
+		{"inject", "switch", "b", "join", "debug"},
+	}, paths)
+	assert.Len(t, g.Paths("inject", "debug", 1), 1)
+	assert.Empty(t, g.Paths("debug", "inject", 0))
+}
+
+func TestGraph_Cycles(t *testing.T) {
+	flow := testFlow()
+	// Feed join back into switch, and add a node wired to itself
+	flow.Nodes[4].Wires = [][]string{{"debug", "switch"}}
+	flow.Nodes = append(flow.Nodes, types.Node{ID: "self", Type: "function", Wires: [][]string{{"self"}}})
+	g := New(flow)
+
+	assert.Equal(t, [][]string{{"a", "join", "switch"}, {"self"}}, g.Cycles())
+
+	var sizes []int
+	for _, component := range g.StronglyConnectedComponents() {
+		sizes = append(sizes, len(component))
+	}
+	assert.ElementsMatch(t, []int{1, 4, 1, 1, 1, 1}, sizes)
+
+	_, err := g.TopologicalOrder()
+	assert.ErrorIs(t, err, ErrCycle)
+}
+
+func TestGraph_Links(t *testing.T) {
+	producer := &types.FlowDefinition{
+		ID: "producer",
+		Nodes: []types.Node{
+			{ID: "start", Type: "inject", Wires: [][]string{{"out"}}},
+			{ID: "out", Type: "link out", Properties: map[string]interface{}{"mode": "link", "links": []interface{}{"in"}}},
+			{ID: "call", Type: "link call", Properties: map[string]interface{}{"links": []string{"svc-in"}}, Wires: [][]string{{"after"}}},
+			{ID: "after", Type: "debug"},
+			{ID: "trigger", Type: "inject", Wires: [][]string{{"call"}}},
+		},
+	}
+	consumer := &types.FlowDefinition{
+		ID: "consumer",
+		Nodes: []types.Node{
+			{ID: "in", Type: "link in", Properties: map[string]interface{}{"links": []interface{}{"out"}}, Wires: [][]string{{"sink"}}},
+			{ID: "sink", Type: "debug"},
+			{ID: "svc-in", Type: "link in", Wires: [][]string{{"svc"}}},
+			{ID: "svc", Type: "function", Wires: [][]string{{"svc-return"}}},
+			{ID: "svc-return", Type: "link out", Properties: map[string]interface{}{"mode": "return"}},
+		},
+	}
+	g := New(producer, consumer)
+
+	assert.Equal(t, []Edge{{From: "out", To: "in", Virtual: true}}, g.Out("out"))
+	assert.Equal(t, []string{"after"}, g.Successors("svc-return"))
+	assert.Equal(t, []string{"start", "out", "in", "sink"}, g.Reachable("start"))
+	assert.Empty(t, g.Unreachable())
+	// The call's own wire stands for the returned message
+	assert.Equal(t, [][]string{
+		{"trigger", "call", "after"},
+		{"trigger", "call", "svc-in", "svc", "svc-return", "after"},
+	}, g.Paths("trigger", "after", 0))
+
+	order, err := g.TopologicalOrder()
+	require.NoError(t, err, "a link call and its return are not a loop")
+	assert.Len(t, order, 10)
+}
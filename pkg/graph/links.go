@@ -0,0 +1,86 @@
+package graph
+
+// resolveLinks adds the virtual edges of link nodes: a link out in link mode
+// feeds the link in nodes it names (either side may list the other), a link
+// call feeds the link in nodes it names, and a link out in return mode feeds
+// whatever is wired to the outputs of the link calls whose messages reach it.
+func (g *Graph) resolveLinks() {
+	for _, id := range g.order {
+		node := g.nodes[id]
+		switch node.Type {
+		case "link out":
+			if node.Properties["mode"] == "return" {
+				continue
+			}
+			for _, target := range stringList(node.Properties["links"]) {
+				if g.nodes[target].Type == "link in" {
+					g.addEdge(Edge{From: id, To: target, Virtual: true})
+				}
+			}
+		case "link in":
+			for _, source := range stringList(node.Properties["links"]) {
+				if source, ok := g.nodes[source]; ok && source.Type == "link out" && source.Properties["mode"] != "return" {
+					g.addEdge(Edge{From: source.ID, To: id, Virtual: true})
+				}
+			}
+		case "link call":
+			for _, target := range stringList(node.Properties["links"]) {
+				if g.nodes[target].Type == "link in" {
+					g.addEdge(Edge{From: id, To: target, Virtual: true})
+				}
+			}
+		}
+	}
+
+	// Returns are resolved once the forward edges exist, since they depend on
+	// which return nodes a call's messages reach
+	type returnEdge struct {
+		from string
+		call string
+	}
+	var returns []returnEdge
+	for _, id := range g.order {
+		if g.nodes[id].Type != "link call" {
+			continue
+		}
+		var targets []string
+		for _, edge := range g.out[id] {
+			if edge.Virtual {
+				targets = append(targets, edge.To)
+			}
+		}
+		for _, reached := range g.Reachable(targets...) {
+			node := g.nodes[reached]
+			if node.Type == "link out" && node.Properties["mode"] == "return" {
+				returns = append(returns, returnEdge{from: reached, call: id})
+			}
+		}
+	}
+
+	for _, r := range returns {
+		for _, edge := range g.out[r.call] {
+			if !edge.Virtual {
+				g.addEdge(Edge{From: r.from, To: edge.To, Virtual: true})
+			}
+		}
+	}
+}
+
+// stringList reads a list of IDs from a node property, which holds []string
+// when built in Go and []interface{} when decoded from JSON
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
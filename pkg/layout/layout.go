@@ -0,0 +1,295 @@
+// Package layout positions the nodes of a flow for the Node-RED editor. Nodes
+// are placed in layers from left to right following the wires, branches of a
+// node are stacked top to bottom in port order, and every coordinate is
+// snapped to the editor's 20px grid.
+package layout
+
+import (
+	"math"
+	"sort"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/graph"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// Grid is the spacing of the Node-RED editor grid
+const Grid = 20
+
+// Default spacing, chosen to fit nodes with a short label
+const (
+	DefaultColumnWidth = 200
+	DefaultRowHeight   = 60
+)
+
+// DefaultOrigin is where the first node of a laid out flow is placed. Node-RED
+// positions are node centers, so the origin leaves room for the first column.
+var DefaultOrigin = types.Position{X: 140, Y: 60}
+
+// Options tunes the layout. Zero values use the defaults.
+type Options struct {
+	Origin      types.Position
+	ColumnWidth float64
+	RowHeight   float64
+	// All lays out every node instead of only those without a position
+	All bool
+}
+
+// Apply returns a copy of the flow in which nodes at Position{0, 0} have been
+// given a position. When other nodes are already placed, the new ones are laid
+// out below them so that nothing overlaps. The caller's flow is not modified.
+func Apply(flow *types.FlowDefinition, options Options) *types.FlowDefinition {
+	if options.ColumnWidth <= 0 {
+		options.ColumnWidth = DefaultColumnWidth
+	}
+	if options.RowHeight <= 0 {
+		options.RowHeight = DefaultRowHeight
+	}
+	if options.Origin == (types.Position{}) {
+		options.Origin = DefaultOrigin
+	}
+
+	laidOut := *flow
+	laidOut.Nodes = make([]types.Node, len(flow.Nodes))
+	copy(laidOut.Nodes, flow.Nodes)
+
+	var pending []types.Node
+	bottom := math.Inf(-1)
+	for _, node := range laidOut.Nodes {
+		if options.All || node.Position == (types.Position{}) {
+			pending = append(pending, node)
+		} else if node.Position.Y > bottom {
+			bottom = node.Position.Y
+		}
+	}
+	if len(pending) == 0 {
+		return &laidOut
+	}
+
+	origin := options.Origin
+	if !math.IsInf(bottom, -1) && bottom+options.RowHeight > origin.Y {
+		origin.Y = bottom + options.RowHeight
+	}
+
+	positions := positionNodes(pending, origin, options)
+	for i, node := range laidOut.Nodes {
+		if position, ok := positions[node.ID]; ok {
+			laidOut.Nodes[i].Position = position
+		}
+	}
+	return &laidOut
+}
+
+// positionNodes lays out each group of connected nodes in turn, stacking the
+// groups vertically
+func positionNodes(nodes []types.Node, origin types.Position, options Options) map[string]types.Position {
+	g := graph.FromNodes(nodes)
+	positions := make(map[string]types.Position, len(nodes))
+
+	y := origin.Y
+	for _, component := range components(g) {
+		layers := orderLayers(g, assignLayers(g, component))
+
+		rows := 0
+		for column, layer := range layers {
+			for row, id := range layer {
+				positions[id] = types.Position{
+					X: snap(origin.X + float64(column)*options.ColumnWidth),
+					Y: snap(y + float64(row)*options.RowHeight),
+				}
+			}
+			if len(layer) > rows {
+				rows = len(layer)
+			}
+		}
+		y += float64(rows) * options.RowHeight
+	}
+	return positions
+}
+
+// snap rounds a coordinate to the nearest grid line
+func snap(v float64) float64 {
+	return math.Round(v/Grid) * Grid
+}
+
+// successors follows wires only; link nodes are drawn where they are wired
+func successors(g *graph.Graph, id string) []string {
+	var next []string
+	seen := map[string]bool{}
+	for _, edge := range g.Out(id) {
+		if !edge.Virtual && !seen[edge.To] {
+			seen[edge.To] = true
+			next = append(next, edge.To)
+		}
+	}
+	return next
+}
+
+func predecessors(g *graph.Graph, id string) []string {
+	var prev []string
+	seen := map[string]bool{}
+	for _, edge := range g.In(id) {
+		if !edge.Virtual && !seen[edge.From] {
+			seen[edge.From] = true
+			prev = append(prev, edge.From)
+		}
+	}
+	return prev
+}
+
+// components groups the nodes that are wired together, in node order
+func components(g *graph.Graph) [][]string {
+	seen := map[string]bool{}
+	var groups [][]string
+
+	for _, start := range g.Nodes() {
+		if seen[start] {
+			continue
+		}
+		var group []string
+		queue := []string{start}
+		seen[start] = true
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			group = append(group, id)
+			for _, next := range append(successors(g, id), predecessors(g, id)...) {
+				if !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// assignLayers puts every node one layer after the furthest node wired into
+// it. Wires closing a loop are ignored so that loops still get an order.
+func assignLayers(g *graph.Graph, component []string) [][]string {
+	position := make(map[string]int, len(component))
+	for i, id := range g.Nodes() {
+		position[id] = i
+	}
+	members := make(map[string]bool, len(component))
+	for _, id := range component {
+		members[id] = true
+	}
+
+	// Walk from the nodes nothing is wired into, in node order, marking wires
+	// that lead back to a node still being walked
+	roots := []string{}
+	for _, id := range component {
+		if len(predecessors(g, id)) == 0 {
+			roots = append(roots, id)
+		}
+	}
+	sorted := append(roots, component...)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	back := map[[2]string]bool{}
+	var order []string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		for _, next := range successors(g, id) {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				back[[2]string{id, next}] = true
+			}
+		}
+		state[id] = done
+		order = append(order, id)
+	}
+	for _, id := range sorted {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+
+	// order is a reverse topological order of the graph without back wires
+	layer := map[string]int{}
+	depth := 0
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		for _, prev := range predecessors(g, id) {
+			if members[prev] && !back[[2]string{prev, id}] && layer[prev]+1 > layer[id] {
+				layer[id] = layer[prev] + 1
+			}
+		}
+		if layer[id] > depth {
+			depth = layer[id]
+		}
+	}
+
+	layers := make([][]string, depth+1)
+	for _, id := range component {
+		layers[layer[id]] = append(layers[layer[id]], id)
+	}
+	for _, l := range layers {
+		sort.SliceStable(l, func(i, j int) bool { return position[l[i]] < position[l[j]] })
+	}
+	return layers
+}
+
+// orderLayers orders the nodes of each layer to keep wires short and
+// uncrossed: a node is placed near the average row of the nodes wired into
+// it, with a node's outputs in port order breaking ties
+func orderLayers(g *graph.Graph, layers [][]string) [][]string {
+	for i := 1; i < len(layers); i++ {
+		sum := make(map[string]float64)
+		count := make(map[string]int)
+		for row, id := range layers[i-1] {
+			targets := outEdges(g, id)
+			for index, target := range targets {
+				// A fraction of a row keeps the branches of a node in port order
+				sum[target] += float64(row) + float64(index)/float64(len(targets)+1)
+				count[target]++
+			}
+		}
+		rank := make(map[string]float64, len(count))
+		for id, n := range count {
+			rank[id] = sum[id] / float64(n)
+		}
+
+		layer := layers[i]
+		previous := make(map[string]int, len(layer))
+		for row, id := range layer {
+			previous[id] = row
+		}
+		sort.SliceStable(layer, func(a, b int) bool {
+			ra, oka := rank[layer[a]]
+			rb, okb := rank[layer[b]]
+			switch {
+			case oka && okb && ra != rb:
+				return ra < rb
+			case oka != okb:
+				return oka
+			default:
+				return previous[layer[a]] < previous[layer[b]]
+			}
+		})
+	}
+	return layers
+}
+
+// outEdges returns the targets of a node's wires in port order
+func outEdges(g *graph.Graph, id string) []string {
+	edges := g.Out(id)
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].Port < edges[j].Port })
+
+	var targets []string
+	for _, edge := range edges {
+		if !edge.Virtual {
+			targets = append(targets, edge.To)
+		}
+	}
+	return targets
+}
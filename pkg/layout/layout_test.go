@@ -0,0 +1,73 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+func positions(flow *types.FlowDefinition) map[string]types.Position {
+	result := make(map[string]types.Position, len(flow.Nodes))
+	for _, node := range flow.Nodes {
+		result[node.ID] = node.Position
+	}
+	return result
+}
+
+func TestApply_Layers(t *testing.T) {
+	flow := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "in", Type: "inject", Wires: [][]string{{"sw"}}},
+			{ID: "sw", Type: "switch", Wires: [][]string{{"low"}, {"high"}}},
+			// Listed out of order: port 0 must still end up above port 1
+			{ID: "high", Type: "change", Wires: [][]string{{"out"}}},
+			{ID: "low", Type: "change", Wires: [][]string{{"out"}}},
+			{ID: "out", Type: "debug"},
+			{ID: "lonely", Type: "debug"},
+		},
+	}
+
+	laidOut := Apply(flow, Options{})
+	got := positions(laidOut)
+
+	assert.Equal(t, types.Position{X: 140, Y: 60}, got["in"])
+	assert.Equal(t, types.Position{X: 340, Y: 60}, got["sw"])
+	assert.Equal(t, types.Position{X: 540, Y: 60}, got["low"])
+	assert.Equal(t, types.Position{X: 540, Y: 120}, got["high"])
+	assert.Equal(t, types.Position{X: 740, Y: 60}, got["out"])
+	// Unconnected nodes are stacked below the flow
+	assert.Equal(t, types.Position{X: 140, Y: 180}, got["lonely"])
+
+	for _, position := range got {
+		assert.Zero(t, int(position.X)%Grid)
+		assert.Zero(t, int(position.Y)%Grid)
+	}
+	assert.Equal(t, types.Position{}, flow.Nodes[0].Position, "the caller's flow is not modified")
+}
+
+func TestApply_KeepsPositions(t *testing.T) {
+	flow := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "placed", Type: "inject", Position: types.Position{X: 300, Y: 200}, Wires: [][]string{{"new"}}},
+			{ID: "new", Type: "function", Wires: [][]string{{"loop"}}},
+			{ID: "loop", Type: "function", Wires: [][]string{{"new"}}},
+		},
+	}
+
+	got := positions(Apply(flow, Options{ColumnWidth: 150, RowHeight: 45}))
+	assert.Equal(t, types.Position{X: 300, Y: 200}, got["placed"])
+	// New nodes go below the placed ones; the loop does not stop the layout
+	assert.Equal(t, types.Position{X: 140, Y: 240}, got["new"])
+	assert.Equal(t, types.Position{X: 300, Y: 240}, got["loop"])
+
+	all := positions(Apply(flow, Options{All: true}))
+	require.Len(t, all, 3)
+	assert.Equal(t, types.Position{X: 140, Y: 60}, all["placed"])
+	assert.Equal(t, types.Position{X: 340, Y: 60}, all["new"])
+	assert.Equal(t, types.Position{X: 540, Y: 60}, all["loop"])
+}
@@ -0,0 +1,388 @@
+package nodes
+
+import (
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// Inject sends a message when triggered manually, once after deploy or on a
+// repeat interval
+type Inject struct {
+	Base
+	// Props are the message properties to set; payload and topic by default
+	Props     []InjectProperty `json:"props"`
+	Repeat    time.Duration    `json:"-"`
+	Crontab   string           `json:"crontab"`
+	Once      bool             `json:"once"`
+	OnceDelay time.Duration    `json:"-"`
+	Topic     string           `json:"topic"`
+	Payload   string           `json:"payload"`
+	// PayloadType is the type of Payload: date (default), str, num, bool, json, ...
+	PayloadType string `json:"payloadType"`
+}
+
+// InjectProperty is a message property set by an inject node. Payload and
+// topic take their value from the node's Payload and Topic fields.
+type InjectProperty struct {
+	Property  string `json:"p"`
+	Value     string `json:"v,omitempty"`
+	ValueType string `json:"vt,omitempty"`
+}
+
+// Type implements Typed
+func (n Inject) Type() string { return "inject" }
+
+// Outputs implements Typed
+func (n Inject) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Inject) ToNode() (types.Node, error) {
+	if n.Props == nil {
+		n.Props = []InjectProperty{{Property: "payload"}, {Property: "topic", ValueType: "str"}}
+	}
+	n.PayloadType = orDefault(n.PayloadType, "date")
+	if n.OnceDelay == 0 {
+		n.OnceDelay = 100 * time.Millisecond
+	}
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["repeat"] = seconds(n.Repeat)
+	properties["onceDelay"] = n.OnceDelay.Seconds()
+	return n.node(n.Type(), properties)
+}
+
+// ParseInject reads an inject node
+func ParseInject(node types.Node) (*Inject, error) {
+	var n Inject
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if n.Repeat, err = parseSeconds(node.Properties["repeat"]); err != nil {
+		return nil, parseError(node, "repeat", err)
+	}
+	if n.OnceDelay, err = parseSeconds(node.Properties["onceDelay"]); err != nil {
+		return nil, parseError(node, "onceDelay", err)
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Debug logs messages to the debug sidebar, the runtime log or the node status
+type Debug struct {
+	Base
+	Active    bool `json:"active"`
+	ToSidebar bool `json:"tosidebar"`
+	Console   bool `json:"console"`
+	ToStatus  bool `json:"tostatus"`
+	// Complete is the property to log, "payload" by default or "true" for the
+	// whole message
+	Complete   string `json:"complete"`
+	TargetType string `json:"targetType"`
+	StatusVal  string `json:"statusVal"`
+	StatusType string `json:"statusType"`
+}
+
+// NewDebug returns a debug node logging msg.payload to the sidebar, as the
+// editor creates it
+func NewDebug() Debug {
+	return Debug{Active: true, ToSidebar: true}
+}
+
+// Type implements Typed
+func (n Debug) Type() string { return "debug" }
+
+// Outputs implements Typed
+func (n Debug) Outputs() int { return 0 }
+
+// ToNode implements Typed
+func (n Debug) ToNode() (types.Node, error) {
+	n.Complete = orDefault(n.Complete, "payload")
+	if n.Complete == "true" {
+		n.TargetType = orDefault(n.TargetType, "full")
+	}
+	n.TargetType = orDefault(n.TargetType, "msg")
+	n.StatusType = orDefault(n.StatusType, "auto")
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseDebug reads a debug node
+func ParseDebug(node types.Node) (*Debug, error) {
+	var n Debug
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Catch receives errors thrown by nodes on the same tab
+type Catch struct {
+	Base
+	// Scope lists the nodes to catch errors from; nil catches all of them
+	Scope []string `json:"scope"`
+	// Uncaught limits the node to errors no other catch node handled
+	Uncaught bool `json:"uncaught"`
+}
+
+// Type implements Typed
+func (n Catch) Type() string { return "catch" }
+
+// Outputs implements Typed
+func (n Catch) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Catch) ToNode() (types.Node, error) {
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseCatch reads a catch node
+func ParseCatch(node types.Node) (*Catch, error) {
+	var n Catch
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Status receives status updates from nodes on the same tab
+type Status struct {
+	Base
+	// Scope lists the nodes to report on; nil reports all of them
+	Scope []string `json:"scope"`
+}
+
+// Type implements Typed
+func (n Status) Type() string { return "status" }
+
+// Outputs implements Typed
+func (n Status) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Status) ToNode() (types.Node, error) {
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseStatus reads a status node
+func ParseStatus(node types.Node) (*Status, error) {
+	var n Status
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Complete is triggered when the listed nodes finish handling a message
+type Complete struct {
+	Base
+	Scope []string `json:"scope"`
+}
+
+// Type implements Typed
+func (n Complete) Type() string { return "complete" }
+
+// Outputs implements Typed
+func (n Complete) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Complete) ToNode() (types.Node, error) {
+	if n.Scope == nil {
+		n.Scope = []string{}
+	}
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseComplete reads a complete node
+func ParseComplete(node types.Node) (*Complete, error) {
+	var n Complete
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// LinkIn receives messages from the link out and link call nodes it is
+// connected to
+type LinkIn struct {
+	Base
+	Links []string `json:"links"`
+}
+
+// Type implements Typed
+func (n LinkIn) Type() string { return "link in" }
+
+// Outputs implements Typed
+func (n LinkIn) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n LinkIn) ToNode() (types.Node, error) {
+	if n.Links == nil {
+		n.Links = []string{}
+	}
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseLinkIn reads a link in node
+func ParseLinkIn(node types.Node) (*LinkIn, error) {
+	var n LinkIn
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// LinkOut sends messages to link in nodes, or back to the link call node that
+// started the message when Mode is "return"
+type LinkOut struct {
+	Base
+	Mode  string   `json:"mode"`
+	Links []string `json:"links"`
+}
+
+// Type implements Typed
+func (n LinkOut) Type() string { return "link out" }
+
+// Outputs implements Typed
+func (n LinkOut) Outputs() int { return 0 }
+
+// ToNode implements Typed
+func (n LinkOut) ToNode() (types.Node, error) {
+	n.Mode = orDefault(n.Mode, "link")
+	if n.Links == nil {
+		n.Links = []string{}
+	}
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseLinkOut reads a link out node
+func ParseLinkOut(node types.Node) (*LinkOut, error) {
+	var n LinkOut
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// LinkCall sends a message to a link in node and waits for a link out node in
+// return mode to send it back
+type LinkCall struct {
+	Base
+	Links []string `json:"links"`
+	// LinkType is "static" (default) or "dynamic" to target msg.target
+	LinkType string `json:"linkType"`
+	// Timeout is how long to wait for the return, 30 seconds by default
+	Timeout time.Duration `json:"-"`
+}
+
+// Type implements Typed
+func (n LinkCall) Type() string { return "link call" }
+
+// Outputs implements Typed
+func (n LinkCall) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n LinkCall) ToNode() (types.Node, error) {
+	n.LinkType = orDefault(n.LinkType, "static")
+	if n.Links == nil {
+		n.Links = []string{}
+	}
+	if n.Timeout == 0 {
+		n.Timeout = 30 * time.Second
+	}
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["timeout"] = seconds(n.Timeout)
+	return n.node(n.Type(), properties)
+}
+
+// ParseLinkCall reads a link call node
+func ParseLinkCall(node types.Node) (*LinkCall, error) {
+	var n LinkCall
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if n.Timeout, err = parseSeconds(node.Properties["timeout"]); err != nil {
+		return nil, parseError(node, "timeout", err)
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
@@ -0,0 +1,453 @@
+package nodes
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// delayUnits are the units of the delay node's timeout and random delays
+var delayUnits = []timeUnit{
+	{"days", 24 * time.Hour},
+	{"hours", time.Hour},
+	{"minutes", time.Minute},
+	{"seconds", time.Second},
+	{"milliseconds", time.Millisecond},
+}
+
+// rateUnits are the units of the delay node's rate limit interval
+var rateUnits = []timeUnit{
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+	{"second", time.Second},
+}
+
+// triggerUnits are the units of the trigger node's duration
+var triggerUnits = []timeUnit{
+	{"hr", time.Hour},
+	{"min", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// Function runs JavaScript against each message
+type Function struct {
+	Base
+	Func string `json:"func"`
+	// Ports is the number of outputs; zero means one
+	Ports      int           `json:"outputs"`
+	Timeout    time.Duration `json:"-"`
+	NoErr      int           `json:"noerr"`
+	Initialize string        `json:"initialize"`
+	Finalize   string        `json:"finalize"`
+	Libs       []FunctionLib `json:"libs"`
+}
+
+// FunctionLib is a module made available to a function node as a variable
+type FunctionLib struct {
+	Var    string `json:"var"`
+	Module string `json:"module"`
+}
+
+// Type implements Typed
+func (n Function) Type() string { return "function" }
+
+// Outputs implements Typed
+func (n Function) Outputs() int {
+	if n.Ports == 0 {
+		return 1
+	}
+	return n.Ports
+}
+
+// ToNode implements Typed
+func (n Function) ToNode() (types.Node, error) {
+	n.Ports = n.Outputs()
+	if n.Libs == nil {
+		n.Libs = []FunctionLib{}
+	}
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["timeout"] = n.Timeout.Seconds()
+	return n.node(n.Type(), properties)
+}
+
+// ParseFunction reads a function node
+func ParseFunction(node types.Node) (*Function, error) {
+	var n Function
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if n.Timeout, err = parseSeconds(node.Properties["timeout"]); err != nil {
+		return nil, parseError(node, "timeout", err)
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Change sets, changes, deletes or moves message properties
+type Change struct {
+	Base
+	Rules []ChangeRule `json:"rules"`
+}
+
+// ChangeRule is one operation of a change node
+type ChangeRule struct {
+	// Action is set, change, delete or move
+	Action string `json:"t"`
+	// Property is the property to operate on, of PropertyType msg (default),
+	// flow or global
+	Property     string `json:"p"`
+	PropertyType string `json:"pt"`
+	To           string `json:"to,omitempty"`
+	ToType       string `json:"tot,omitempty"`
+	From         string `json:"from,omitempty"`
+	FromType     string `json:"fromt,omitempty"`
+}
+
+// SetRule sets msg.<property> to a value of the given type (str, num, json, ...)
+func SetRule(property, value, valueType string) ChangeRule {
+	return ChangeRule{Action: "set", Property: property, PropertyType: "msg", To: value, ToType: valueType}
+}
+
+// DeleteRule deletes msg.<property>
+func DeleteRule(property string) ChangeRule {
+	return ChangeRule{Action: "delete", Property: property, PropertyType: "msg"}
+}
+
+// MoveRule moves msg.<from> to msg.<to>
+func MoveRule(from, to string) ChangeRule {
+	return ChangeRule{Action: "move", Property: from, PropertyType: "msg", To: to, ToType: "msg"}
+}
+
+// Type implements Typed
+func (n Change) Type() string { return "change" }
+
+// Outputs implements Typed
+func (n Change) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Change) ToNode() (types.Node, error) {
+	rules := make([]ChangeRule, len(n.Rules))
+	for i, rule := range n.Rules {
+		rule.PropertyType = orDefault(rule.PropertyType, "msg")
+		rules[i] = rule
+	}
+	n.Rules = rules
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseChange reads a change node
+func ParseChange(node types.Node) (*Change, error) {
+	var n Change
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Switch routes messages to the outputs of the rules they match, one output
+// per rule
+type Switch struct {
+	Base
+	Property     string       `json:"property"`
+	PropertyType string       `json:"propertyType"`
+	Rules        []SwitchRule `json:"rules"`
+	// StopOnFirstMatch sends a message only to the first matching rule
+	// instead of every one
+	StopOnFirstMatch bool `json:"-"`
+	Repair           bool `json:"repair"`
+}
+
+// SwitchRule is a test applied by a switch node
+type SwitchRule struct {
+	// Operator is eq, neq, lt, lte, gt, gte, btwn, cont, regex, true, false,
+	// null, nnull, empty, nempty, istype, else, ...
+	Operator   string `json:"t"`
+	Value      string `json:"v,omitempty"`
+	ValueType  string `json:"vt,omitempty"`
+	Value2     string `json:"v2,omitempty"`
+	Value2Type string `json:"v2t,omitempty"`
+	IgnoreCase bool   `json:"case,omitempty"`
+}
+
+// Type implements Typed
+func (n Switch) Type() string { return "switch" }
+
+// Outputs implements Typed
+func (n Switch) Outputs() int { return len(n.Rules) }
+
+// ToNode implements Typed
+func (n Switch) ToNode() (types.Node, error) {
+	n.Property = orDefault(n.Property, "payload")
+	n.PropertyType = orDefault(n.PropertyType, "msg")
+	if n.Rules == nil {
+		n.Rules = []SwitchRule{}
+	}
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["checkall"] = strconv.FormatBool(!n.StopOnFirstMatch)
+	properties["outputs"] = n.Outputs()
+	return n.node(n.Type(), properties)
+}
+
+// ParseSwitch reads a switch node
+func ParseSwitch(node types.Node) (*Switch, error) {
+	var n Switch
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	checkAll := true
+	if value, ok := node.Properties["checkall"]; ok {
+		var err error
+		if checkAll, err = parseBool(value); err != nil {
+			return nil, parseError(node, "checkall", err)
+		}
+	}
+	n.StopOnFirstMatch = !checkAll
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Template renders a mustache template into a message property
+type Template struct {
+	Base
+	Field     string `json:"field"`
+	FieldType string `json:"fieldType"`
+	// Format is the editor syntax highlighting: handlebars (default), html,
+	// json, javascript, yaml, text, ...
+	Format string `json:"format"`
+	// Syntax is mustache (default) or plain
+	Syntax   string `json:"syntax"`
+	Template string `json:"template"`
+	// Output is str (default), json or yaml
+	Output string `json:"output"`
+}
+
+// Type implements Typed
+func (n Template) Type() string { return "template" }
+
+// Outputs implements Typed
+func (n Template) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Template) ToNode() (types.Node, error) {
+	n.Field = orDefault(n.Field, "payload")
+	n.FieldType = orDefault(n.FieldType, "msg")
+	n.Format = orDefault(n.Format, "handlebars")
+	n.Syntax = orDefault(n.Syntax, "mustache")
+	n.Output = orDefault(n.Output, "str")
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseTemplate reads a template node
+func ParseTemplate(node types.Node) (*Template, error) {
+	var n Template
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Delay delays messages or limits their rate
+type Delay struct {
+	Base
+	// PauseType is delay (default), delayv, random, rate, queue or timed
+	PauseType string        `json:"pauseType"`
+	Timeout   time.Duration `json:"-"`
+	// Rate messages are let through per RateInterval, by default 1 per second
+	Rate         float64       `json:"-"`
+	RateInterval time.Duration `json:"-"`
+	RandomFirst  time.Duration `json:"-"`
+	RandomLast   time.Duration `json:"-"`
+	// Drop discards messages over the rate limit instead of queueing them
+	Drop      bool `json:"drop"`
+	AllowRate bool `json:"allowrate"`
+}
+
+// Type implements Typed
+func (n Delay) Type() string { return "delay" }
+
+// Outputs implements Typed
+func (n Delay) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Delay) ToNode() (types.Node, error) {
+	n.PauseType = orDefault(n.PauseType, "delay")
+	if n.Rate == 0 {
+		n.Rate = 1
+	}
+	if n.RateInterval == 0 {
+		n.RateInterval = time.Second
+	}
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["timeout"], properties["timeoutUnits"] = formatDuration(n.Timeout, delayUnits)
+	properties["rate"] = formatNumber(n.Rate)
+	properties["nbRateUnits"], properties["rateUnits"] = formatDuration(n.RateInterval, rateUnits)
+
+	// Both random bounds share one unit
+	first, last := n.RandomFirst, n.RandomLast
+	unit := delayUnits[len(delayUnits)-1]
+	for _, u := range delayUnits {
+		if first%u.size == 0 && last%u.size == 0 && (first > 0 || last > 0) {
+			unit = u
+			break
+		}
+	}
+	properties["randomFirst"] = formatNumber(float64(first) / float64(unit.size))
+	properties["randomLast"] = formatNumber(float64(last) / float64(unit.size))
+	properties["randomUnits"] = unit.name
+	properties["outputs"] = n.Outputs()
+	return n.node(n.Type(), properties)
+}
+
+// ParseDelay reads a delay node
+func ParseDelay(node types.Node) (*Delay, error) {
+	var n Delay
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	props := node.Properties
+	var err error
+	if n.Timeout, err = parseDuration(props["timeout"], unitName(props["timeoutUnits"], "seconds"), delayUnits); err != nil {
+		return nil, parseError(node, "timeout", err)
+	}
+	if n.Rate, err = parseNumber(props["rate"]); err != nil {
+		return nil, parseError(node, "rate", err)
+	}
+	if n.RateInterval, err = parseDuration(props["nbRateUnits"], unitName(props["rateUnits"], "second"), rateUnits); err != nil {
+		return nil, parseError(node, "nbRateUnits", err)
+	}
+	randomUnit := unitName(props["randomUnits"], "seconds")
+	if n.RandomFirst, err = parseDuration(props["randomFirst"], randomUnit, delayUnits); err != nil {
+		return nil, parseError(node, "randomFirst", err)
+	}
+	if n.RandomLast, err = parseDuration(props["randomLast"], randomUnit, delayUnits); err != nil {
+		return nil, parseError(node, "randomLast", err)
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Trigger sends a message, then a second one after a duration unless it is
+// extended or reset
+type Trigger struct {
+	Base
+	Op1     string `json:"op1"`
+	Op1Type string `json:"op1type"`
+	Op2     string `json:"op2"`
+	Op2Type string `json:"op2type"`
+	// Duration before the second message; zero waits until reset
+	Duration      time.Duration `json:"-"`
+	Extend        bool          `json:"extend"`
+	OverrideDelay bool          `json:"overrideDelay"`
+	Reset         string        `json:"reset"`
+	// ByTopic is all (default) or topic to handle each msg.topic separately
+	ByTopic string `json:"bytopic"`
+	Topic   string `json:"topic"`
+	// SecondOutput sends the second message to a separate output
+	SecondOutput bool `json:"-"`
+}
+
+// Type implements Typed
+func (n Trigger) Type() string { return "trigger" }
+
+// Outputs implements Typed
+func (n Trigger) Outputs() int {
+	if n.SecondOutput {
+		return 2
+	}
+	return 1
+}
+
+// ToNode implements Typed
+func (n Trigger) ToNode() (types.Node, error) {
+	n.Op1Type = orDefault(n.Op1Type, "str")
+	n.Op2Type = orDefault(n.Op2Type, "str")
+	n.ByTopic = orDefault(n.ByTopic, "all")
+	n.Topic = orDefault(n.Topic, "topic")
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["duration"], properties["units"] = formatDuration(n.Duration, triggerUnits)
+	properties["outputs"] = n.Outputs()
+	return n.node(n.Type(), properties)
+}
+
+// ParseTrigger reads a trigger node
+func ParseTrigger(node types.Node) (*Trigger, error) {
+	var n Trigger
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if n.Duration, err = parseDuration(node.Properties["duration"], unitName(node.Properties["units"], "ms"), triggerUnits); err != nil {
+		return nil, parseError(node, "duration", err)
+	}
+	outputs, err := parseNumber(node.Properties["outputs"])
+	if err != nil {
+		return nil, parseError(node, "outputs", err)
+	}
+	n.SecondOutput = outputs == 2
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
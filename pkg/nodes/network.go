@@ -0,0 +1,270 @@
+package nodes
+
+import (
+	"strconv"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// HTTPIn creates an HTTP endpoint on Node-RED's httpNodeRoot. Requests must be
+// answered by an HTTPResponse node.
+type HTTPIn struct {
+	Base
+	// Method is get (default), post, put, delete or patch
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	Upload     bool   `json:"upload"`
+	SwaggerDoc string `json:"swaggerDoc"`
+}
+
+// Type implements Typed
+func (n HTTPIn) Type() string { return "http in" }
+
+// Outputs implements Typed
+func (n HTTPIn) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n HTTPIn) ToNode() (types.Node, error) {
+	n.Method = orDefault(n.Method, "get")
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseHTTPIn reads an http in node
+func ParseHTTPIn(node types.Node) (*HTTPIn, error) {
+	var n HTTPIn
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// HTTPResponse answers the request that started the message
+type HTTPResponse struct {
+	Base
+	// StatusCode overrides msg.statusCode when set
+	StatusCode int               `json:"-"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// Type implements Typed
+func (n HTTPResponse) Type() string { return "http response" }
+
+// Outputs implements Typed
+func (n HTTPResponse) Outputs() int { return 0 }
+
+// ToNode implements Typed
+func (n HTTPResponse) ToNode() (types.Node, error) {
+	if n.Headers == nil {
+		n.Headers = map[string]string{}
+	}
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["statusCode"] = ""
+	if n.StatusCode != 0 {
+		properties["statusCode"] = strconv.Itoa(n.StatusCode)
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseHTTPResponse reads an http response node
+func ParseHTTPResponse(node types.Node) (*HTTPResponse, error) {
+	var n HTTPResponse
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	code, err := parseNumber(node.Properties["statusCode"])
+	if err != nil {
+		return nil, parseError(node, "statusCode", err)
+	}
+	n.StatusCode = int(code)
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// HTTPRequest sends an HTTP request and outputs the response
+type HTTPRequest struct {
+	Base
+	// Method is GET (default), POST, PUT, DELETE, HEAD or use to take msg.method
+	Method string `json:"method"`
+	// Ret is the response type: txt (default), bin or obj for parsed JSON
+	Ret string `json:"ret"`
+	// PayToQS is ignore (default), query or body for sending msg.payload
+	PayToQS            string       `json:"paytoqs"`
+	URL                string       `json:"url"`
+	TLS                string       `json:"tls"`
+	Persist            bool         `json:"persist"`
+	Proxy              string       `json:"proxy"`
+	InsecureHTTPParser bool         `json:"insecureHTTPParser"`
+	AuthType           string       `json:"authType"`
+	SendErr            bool         `json:"senderr"`
+	Headers            []HTTPHeader `json:"headers"`
+}
+
+// HTTPHeader is a request header set by an http request node
+type HTTPHeader struct {
+	KeyType    string `json:"keyType"`
+	KeyValue   string `json:"keyValue"`
+	ValueType  string `json:"valueType"`
+	ValueValue string `json:"valueValue"`
+}
+
+// Type implements Typed
+func (n HTTPRequest) Type() string { return "http request" }
+
+// Outputs implements Typed
+func (n HTTPRequest) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n HTTPRequest) ToNode() (types.Node, error) {
+	n.Method = orDefault(n.Method, "GET")
+	n.Ret = orDefault(n.Ret, "txt")
+	n.PayToQS = orDefault(n.PayToQS, "ignore")
+	if n.Headers == nil {
+		n.Headers = []HTTPHeader{}
+	}
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseHTTPRequest reads an http request node
+func ParseHTTPRequest(node types.Node) (*HTTPRequest, error) {
+	var n HTTPRequest
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// MQTTIn subscribes to an MQTT topic on the broker config node Broker
+type MQTTIn struct {
+	Base
+	Topic string `json:"topic"`
+	QoS   int    `json:"-"`
+	// DataType is auto-detect (default), buffer, utf8, json or base64
+	DataType          string `json:"datatype"`
+	Broker            string `json:"broker"`
+	NoLocal           bool   `json:"nl"`
+	RetainAsPublished bool   `json:"rap"`
+	RetainHandling    int    `json:"rh"`
+	// Dynamic subscribes to topics given by input messages instead of Topic
+	Dynamic bool `json:"-"`
+}
+
+// Type implements Typed
+func (n MQTTIn) Type() string { return "mqtt in" }
+
+// Outputs implements Typed
+func (n MQTTIn) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n MQTTIn) ToNode() (types.Node, error) {
+	n.DataType = orDefault(n.DataType, "auto-detect")
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["qos"] = strconv.Itoa(n.QoS)
+	properties["inputs"] = 0
+	if n.Dynamic {
+		properties["inputs"] = 1
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseMQTTIn reads an mqtt in node
+func ParseMQTTIn(node types.Node) (*MQTTIn, error) {
+	var n MQTTIn
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	qos, err := parseNumber(node.Properties["qos"])
+	if err != nil {
+		return nil, parseError(node, "qos", err)
+	}
+	n.QoS = int(qos)
+	inputs, err := parseNumber(node.Properties["inputs"])
+	if err != nil {
+		return nil, parseError(node, "inputs", err)
+	}
+	n.Dynamic = inputs > 0
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// MQTTOut publishes messages to the broker config node Broker. Empty Topic,
+// QoS and Retain are taken from the message.
+type MQTTOut struct {
+	Base
+	Topic       string `json:"topic"`
+	QoS         string `json:"qos"`
+	Retain      string `json:"retain"`
+	RespTopic   string `json:"respTopic"`
+	ContentType string `json:"contentType"`
+	Expiry      string `json:"expiry"`
+	Broker      string `json:"broker"`
+}
+
+// Type implements Typed
+func (n MQTTOut) Type() string { return "mqtt out" }
+
+// Outputs implements Typed
+func (n MQTTOut) Outputs() int { return 0 }
+
+// ToNode implements Typed
+func (n MQTTOut) ToNode() (types.Node, error) {
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseMQTTOut reads an mqtt out node
+func ParseMQTTOut(node types.Node) (*MQTTOut, error) {
+	var n MQTTOut
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
@@ -0,0 +1,272 @@
+// Package nodes provides typed structs for the core Node-RED palette. Each
+// struct marshals into the properties Node-RED expects and can be parsed back
+// from a types.Node read from an instance. The structs satisfy flow.NodeSpec,
+// so they can be chained with the flow builder:
+//
+//	flow.New("api").
+//		Start(nodes.HTTPIn{Method: "post", URL: "/orders"}).
+//		Then(nodes.Function{Func: "return msg;"}).
+//		Then(nodes.HTTPResponse{})
+package nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// ErrUnknownType is returned by Parse for node types without a typed struct
+var ErrUnknownType = errors.New("unknown node type")
+
+// Typed is a node with typed properties
+type Typed interface {
+	// Type returns the Node-RED node type
+	Type() string
+	// ToNode returns the node without wires, or an error when its properties
+	// cannot be encoded as JSON
+	ToNode() (types.Node, error)
+	// Outputs returns the number of output ports of the node
+	Outputs() int
+}
+
+// Base holds the fields every node has. Properties present on a parsed node
+// that the typed struct does not know are kept in Extra and written back by
+// ToNode, so reading and redeploying a flow does not lose them.
+type Base struct {
+	ID       string                 `json:"-"`
+	Name     string                 `json:"-"`
+	Position types.Position         `json:"-"`
+	Extra    map[string]interface{} `json:"-"`
+}
+
+// parsers maps node types to the function parsing them
+var parsers = map[string]func(types.Node) (Typed, error){
+	"inject":        func(n types.Node) (Typed, error) { return ParseInject(n) },
+	"debug":         func(n types.Node) (Typed, error) { return ParseDebug(n) },
+	"function":      func(n types.Node) (Typed, error) { return ParseFunction(n) },
+	"change":        func(n types.Node) (Typed, error) { return ParseChange(n) },
+	"switch":        func(n types.Node) (Typed, error) { return ParseSwitch(n) },
+	"template":      func(n types.Node) (Typed, error) { return ParseTemplate(n) },
+	"delay":         func(n types.Node) (Typed, error) { return ParseDelay(n) },
+	"trigger":       func(n types.Node) (Typed, error) { return ParseTrigger(n) },
+	"http in":       func(n types.Node) (Typed, error) { return ParseHTTPIn(n) },
+	"http response": func(n types.Node) (Typed, error) { return ParseHTTPResponse(n) },
+	"http request":  func(n types.Node) (Typed, error) { return ParseHTTPRequest(n) },
+	"mqtt in":       func(n types.Node) (Typed, error) { return ParseMQTTIn(n) },
+	"mqtt out":      func(n types.Node) (Typed, error) { return ParseMQTTOut(n) },
+	"link in":       func(n types.Node) (Typed, error) { return ParseLinkIn(n) },
+	"link out":      func(n types.Node) (Typed, error) { return ParseLinkOut(n) },
+	"link call":     func(n types.Node) (Typed, error) { return ParseLinkCall(n) },
+	"catch":         func(n types.Node) (Typed, error) { return ParseCatch(n) },
+	"status":        func(n types.Node) (Typed, error) { return ParseStatus(n) },
+	"complete":      func(n types.Node) (Typed, error) { return ParseComplete(n) },
+	"split":         func(n types.Node) (Typed, error) { return ParseSplit(n) },
+	"join":          func(n types.Node) (Typed, error) { return ParseJoin(n) },
+}
+
+// Parse returns the typed struct for a node, or ErrUnknownType when its type
+// is not part of the core palette
+func Parse(node types.Node) (Typed, error) {
+	parse, ok := parsers[node.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, node.Type)
+	}
+	return parse(node)
+}
+
+// node builds a types.Node from the base fields and the typed properties,
+// with Extra underneath so that typed values win
+func (b Base) node(nodeType string, properties map[string]interface{}) (types.Node, error) {
+	if _, err := json.Marshal(b.Extra); err != nil {
+		return types.Node{}, fmt.Errorf("failed to encode %s node %s: invalid extra properties: %w", nodeType, b.ID, err)
+	}
+
+	merged := make(map[string]interface{}, len(b.Extra)+len(properties))
+	for key, value := range b.Extra {
+		merged[key] = value
+	}
+	for key, value := range properties {
+		merged[key] = value
+	}
+
+	return types.Node{
+		ID:         b.ID,
+		Type:       nodeType,
+		Name:       b.Name,
+		Position:   b.Position,
+		Properties: merged,
+	}, nil
+}
+
+// encode returns the JSON-tagged fields of a typed node as properties
+func encode(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", v, err)
+	}
+
+	properties := make(map[string]interface{})
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", v, err)
+	}
+	return properties, nil
+}
+
+// decode fills a typed node from the node's properties
+func decode(node types.Node, nodeType string, v interface{}, base *Base) error {
+	if node.Type != nodeType {
+		return fmt.Errorf("node %s has type %q, not %q", node.ID, node.Type, nodeType)
+	}
+
+	data, err := json.Marshal(node.Properties)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s node %s: %w", nodeType, node.ID, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s node %s: %w", nodeType, node.ID, err)
+	}
+
+	base.ID = node.ID
+	base.Name = node.Name
+	base.Position = node.Position
+	return nil
+}
+
+// extra returns the properties of node that the typed node does not produce
+func extra(node types.Node, typed Typed) (map[string]interface{}, error) {
+	known, err := typed.ToNode()
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown map[string]interface{}
+	for key, value := range node.Properties {
+		if _, ok := known.Properties[key]; ok {
+			continue
+		}
+		if unknown == nil {
+			unknown = make(map[string]interface{})
+		}
+		unknown[key] = value
+	}
+	return unknown, nil
+}
+
+// parseError wraps an error converting a property of a parsed node
+func parseError(node types.Node, property string, err error) error {
+	return fmt.Errorf("failed to parse %s node %s: invalid %s: %w", node.Type, node.ID, property, err)
+}
+
+// formatNumber renders a number the way the Node-RED editor stores numeric
+// fields, as a string without trailing zeros
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// parseNumber reads a numeric property stored either as a string or a number.
+// An empty or missing value is zero.
+func parseNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("unexpected value %v", value)
+	}
+}
+
+// parseBool reads a boolean property stored either as a bool or a string
+func parseBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		if v == "" {
+			return false, nil
+		}
+		return strconv.ParseBool(v)
+	default:
+		return false, fmt.Errorf("unexpected value %v", value)
+	}
+}
+
+// timeUnit is a unit a node stores durations in
+type timeUnit struct {
+	name string
+	size time.Duration
+}
+
+// formatDuration splits d into a value and the largest unit that represents
+// it exactly; units are ordered from largest to smallest
+func formatDuration(d time.Duration, units []timeUnit) (string, string) {
+	smallest := units[len(units)-1]
+	for _, unit := range units {
+		if d > 0 && d%unit.size == 0 {
+			return formatNumber(float64(d / unit.size)), unit.name
+		}
+	}
+	return formatNumber(float64(d) / float64(smallest.size)), smallest.name
+}
+
+// parseDuration converts a value stored in the named unit back to a duration
+func parseDuration(value interface{}, unitName string, units []timeUnit) (time.Duration, error) {
+	n, err := parseNumber(value)
+	if err != nil {
+		return 0, err
+	}
+	for _, unit := range units {
+		if unit.name == unitName {
+			return time.Duration(math.Round(n * float64(unit.size))), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown unit %q", unitName)
+}
+
+// unitName returns the unit stored in a property, or fallback when unset
+func unitName(value interface{}, fallback string) string {
+	if name, ok := value.(string); ok && name != "" {
+		return name
+	}
+	return fallback
+}
+
+// seconds formats a duration as a number of seconds, the unit used by inject
+// repeats and timeouts; zero is the empty string
+func seconds(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return formatNumber(d.Seconds())
+}
+
+// parseSeconds is the inverse of seconds
+func parseSeconds(value interface{}) (time.Duration, error) {
+	n, err := parseNumber(value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(math.Round(n * float64(time.Second))), nil
+}
+
+// orDefault returns value, or fallback when value is empty
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,157 @@
+package nodes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/flow"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+func TestNodes_RoundTrip(t *testing.T) {
+	base := Base{ID: "n1", Name: "node", Position: types.Position{X: 10, Y: 20}}
+
+	tests := []Typed{
+		Inject{Base: base, Props: []InjectProperty{{Property: "payload"}}, Repeat: time.Minute, Once: true, OnceDelay: 2 * time.Second, Topic: "tick", Payload: "42", PayloadType: "num"},
+		Debug{Base: base, Active: true, ToSidebar: true, Complete: "true", TargetType: "full", StatusType: "auto"},
+		Function{Base: base, Func: "return [msg, null];", Ports: 2, Timeout: 5 * time.Second, Libs: []FunctionLib{{Var: "os", Module: "os"}}},
+		Change{Base: base, Rules: []ChangeRule{SetRule("payload", "hi", "str"), DeleteRule("topic"), MoveRule("a", "b")}},
+		Switch{Base: base, Property: "payload", PropertyType: "msg", Rules: []SwitchRule{{Operator: "gt", Value: "5", ValueType: "num"}, {Operator: "else"}}, StopOnFirstMatch: true},
+		Template{Base: base, Field: "payload", FieldType: "msg", Format: "json", Syntax: "mustache", Template: `{"a":"{{payload}}"}`, Output: "json"},
+		Delay{Base: base, PauseType: "rate", Timeout: 1500 * time.Millisecond, Rate: 10, RateInterval: time.Minute, RandomFirst: time.Second, RandomLast: 5 * time.Second, Drop: true},
+		Trigger{Base: base, Op1: "1", Op1Type: "str", Op2: "0", Op2Type: "num", Duration: 2 * time.Minute, Extend: true, ByTopic: "topic", Topic: "topic", SecondOutput: true},
+		HTTPIn{Base: base, Method: "post", URL: "/orders"},
+		HTTPResponse{Base: base, StatusCode: 201, Headers: map[string]string{"x-id": "1"}},
+		HTTPRequest{Base: base, Method: "POST", Ret: "obj", PayToQS: "body", URL: "http://example.com", Headers: []HTTPHeader{{KeyType: "other", KeyValue: "x-key", ValueType: "other", ValueValue: "v"}}},
+		MQTTIn{Base: base, Topic: "sensors/#", QoS: 1, DataType: "json", Broker: "broker-1", Dynamic: true},
+		MQTTOut{Base: base, Topic: "out", QoS: "1", Retain: "true", Broker: "broker-1"},
+		LinkIn{Base: base, Links: []string{"out-1"}},
+		LinkOut{Base: base, Mode: "return", Links: []string{}},
+		LinkCall{Base: base, Links: []string{"in-1"}, LinkType: "static", Timeout: 10 * time.Second},
+		Catch{Base: base, Scope: []string{"n2"}, Uncaught: true},
+		Status{Base: base},
+		Complete{Base: base, Scope: []string{"n2"}},
+		Split{Base: base, Splt: ",", SpltType: "str", ArraySplt: 2, ArraySpltType: "len", AddName: "topic"},
+		Join{Base: base, Mode: "custom", Build: "array", Property: "payload", PropertyType: "msg", Key: "topic", Joiner: `\n`, JoinerType: "str", Count: 3, Timeout: 30 * time.Second},
+	}
+
+	for _, typed := range tests {
+		t.Run(typed.Type(), func(t *testing.T) {
+			node, err := typed.ToNode()
+			require.NoError(t, err)
+			assert.Equal(t, typed.Type(), node.Type)
+			assert.Equal(t, "n1", node.ID)
+
+			// Properties must survive the trip through Node-RED's JSON
+			data, err := json.Marshal(node.Properties)
+			require.NoError(t, err)
+			node.Properties = map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(data, &node.Properties))
+
+			parsed, err := Parse(node)
+			require.NoError(t, err)
+			assert.Equal(t, typed, reflect.ValueOf(parsed).Elem().Interface())
+		})
+	}
+}
+
+func TestNodes_Properties(t *testing.T) {
+	inject := toNode(t, Inject{Repeat: 90 * time.Second})
+	assert.Equal(t, "90", inject.Properties["repeat"])
+	assert.Equal(t, "date", inject.Properties["payloadType"])
+	assert.Equal(t, 0.1, inject.Properties["onceDelay"])
+
+	delay := toNode(t, Delay{Timeout: 1500 * time.Millisecond})
+	assert.Equal(t, "1500", delay.Properties["timeout"])
+	assert.Equal(t, "milliseconds", delay.Properties["timeoutUnits"])
+
+	delay = toNode(t, Delay{Timeout: 2 * time.Hour})
+	assert.Equal(t, "2", delay.Properties["timeout"])
+	assert.Equal(t, "hours", delay.Properties["timeoutUnits"])
+
+	sw := toNode(t, Switch{Rules: []SwitchRule{{Operator: "eq", Value: "a", ValueType: "str"}, {Operator: "else"}}})
+	assert.Equal(t, 2, sw.Properties["outputs"])
+	assert.Equal(t, "true", sw.Properties["checkall"])
+
+	debug := toNode(t, NewDebug())
+	assert.Equal(t, true, debug.Properties["active"])
+	assert.Equal(t, "payload", debug.Properties["complete"])
+}
+
+func TestNodes_ParseEditorExport(t *testing.T) {
+	// An inject node as exported by the Node-RED 3.x editor
+	raw := `{
+		"props": [{"p": "payload"}, {"p": "topic", "vt": "str"}],
+		"repeat": "3600",
+		"crontab": "",
+		"once": false,
+		"onceDelay": 0.1,
+		"topic": "",
+		"payload": "",
+		"payloadType": "date",
+		"g": "group-1"
+	}`
+	node := types.Node{ID: "a1b2c3d4e5f60718", Type: "inject", Name: "hourly"}
+	require.NoError(t, json.Unmarshal([]byte(raw), &node.Properties))
+
+	inject, err := ParseInject(node)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, inject.Repeat)
+	assert.Equal(t, "hourly", inject.Name)
+	assert.Equal(t, map[string]interface{}{"g": "group-1"}, inject.Extra)
+
+	// Unknown properties are written back on redeploy
+	assert.Equal(t, "group-1", toNode(t, inject).Properties["g"])
+
+	_, err = ParseDebug(node)
+	assert.Error(t, err)
+
+	_, err = Parse(types.Node{ID: "x", Type: "ui_button"})
+	assert.ErrorIs(t, err, ErrUnknownType)
+
+	_, err = ParseInject(types.Node{ID: "x", Type: "inject", Properties: map[string]interface{}{"repeat": "soon"}})
+	assert.ErrorContains(t, err, "invalid repeat")
+}
+
+func TestNodes_Builder(t *testing.T) {
+	def, err := flow.New("api").
+		Start(HTTPIn{Method: "post", URL: "/orders"}).
+		Then(Switch{Rules: []SwitchRule{{Operator: "nnull"}, {Operator: "else"}}}).
+		Branch(
+			func(c *flow.Chain) { c.Then(HTTPResponse{StatusCode: 200}) },
+			func(c *flow.Chain) { c.Then(HTTPResponse{StatusCode: 400}) },
+		).
+		Build()
+	require.NoError(t, err)
+
+	require.Len(t, def.Nodes, 4)
+	assert.Equal(t, "http in", def.Nodes[0].Type)
+	assert.Len(t, def.Nodes[1].Wires, 2)
+	assert.Equal(t, [][]string{{def.Nodes[2].ID}, {def.Nodes[3].ID}}, def.Nodes[1].Wires)
+	assert.Empty(t, def.Nodes[2].Wires)
+}
+
+func TestNodes_EncodeError(t *testing.T) {
+	debug := NewDebug()
+	debug.ID = "d1"
+	debug.Extra = map[string]interface{}{"callback": func() {}}
+
+	_, err := debug.ToNode()
+	assert.ErrorContains(t, err, "debug node d1: invalid extra properties")
+
+	_, err = flow.New("api").Start(Inject{}).Then(debug).Build()
+	assert.ErrorContains(t, err, "invalid extra properties")
+}
+
+// toNode converts a typed node, failing the test on error
+func toNode(t *testing.T, typed Typed) types.Node {
+	t.Helper()
+	node, err := typed.ToNode()
+	require.NoError(t, err)
+	return node
+}
@@ -0,0 +1,135 @@
+package nodes
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// Split turns one message into a sequence of messages
+type Split struct {
+	Base
+	// Splt is the string split on, a newline by default
+	Splt string `json:"splt"`
+	// SpltType is str (default), bin or len
+	SpltType      string `json:"spltType"`
+	ArraySplt     int    `json:"arraySplt"`
+	ArraySpltType string `json:"arraySpltType"`
+	Stream        bool   `json:"stream"`
+	// AddName copies each object key to this message property
+	AddName string `json:"addname"`
+}
+
+// Type implements Typed
+func (n Split) Type() string { return "split" }
+
+// Outputs implements Typed
+func (n Split) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Split) ToNode() (types.Node, error) {
+	n.Splt = orDefault(n.Splt, `\n`)
+	n.SpltType = orDefault(n.SpltType, "str")
+	if n.ArraySplt == 0 {
+		n.ArraySplt = 1
+	}
+	n.ArraySpltType = orDefault(n.ArraySpltType, "len")
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	return n.node(n.Type(), properties)
+}
+
+// ParseSplit reads a split node
+func ParseSplit(node types.Node) (*Split, error) {
+	var n Split
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
+
+// Join combines a sequence of messages into one
+type Join struct {
+	Base
+	// Mode is auto (default) to undo a split, custom or reduce
+	Mode string `json:"mode"`
+	// Build is string, array, object (default), merged or buffer
+	Build        string `json:"build"`
+	Property     string `json:"property"`
+	PropertyType string `json:"propertyType"`
+	Key          string `json:"key"`
+	Joiner       string `json:"joiner"`
+	JoinerType   string `json:"joinerType"`
+	Accumulate   bool   `json:"accumulate"`
+	// Count sends the message after this many parts; zero waits for
+	// msg.complete or Timeout
+	Count   int           `json:"-"`
+	Timeout time.Duration `json:"-"`
+
+	ReduceRight    bool   `json:"reduceRight"`
+	ReduceExp      string `json:"reduceExp"`
+	ReduceInit     string `json:"reduceInit"`
+	ReduceInitType string `json:"reduceInitType"`
+	ReduceFixup    string `json:"reduceFixup"`
+}
+
+// Type implements Typed
+func (n Join) Type() string { return "join" }
+
+// Outputs implements Typed
+func (n Join) Outputs() int { return 1 }
+
+// ToNode implements Typed
+func (n Join) ToNode() (types.Node, error) {
+	n.Mode = orDefault(n.Mode, "auto")
+	n.Build = orDefault(n.Build, "object")
+	n.Property = orDefault(n.Property, "payload")
+	n.PropertyType = orDefault(n.PropertyType, "msg")
+	n.Key = orDefault(n.Key, "topic")
+	n.Joiner = orDefault(n.Joiner, `\n`)
+	n.JoinerType = orDefault(n.JoinerType, "str")
+
+	properties, err := encode(n)
+	if err != nil {
+		return types.Node{}, err
+	}
+	properties["count"] = ""
+	if n.Count != 0 {
+		properties["count"] = strconv.Itoa(n.Count)
+	}
+	properties["timeout"] = seconds(n.Timeout)
+	return n.node(n.Type(), properties)
+}
+
+// ParseJoin reads a join node
+func ParseJoin(node types.Node) (*Join, error) {
+	var n Join
+	if err := decode(node, n.Type(), &n, &n.Base); err != nil {
+		return nil, err
+	}
+
+	count, err := parseNumber(node.Properties["count"])
+	if err != nil {
+		return nil, parseError(node, "count", err)
+	}
+	n.Count = int(count)
+	if n.Timeout, err = parseSeconds(node.Properties["timeout"]); err != nil {
+		return nil, parseError(node, "timeout", err)
+	}
+
+	unknown, err := extra(node, n)
+	if err != nil {
+		return nil, err
+	}
+	n.Extra = unknown
+	return &n, nil
+}
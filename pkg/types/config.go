@@ -0,0 +1,50 @@
+package types
+
+// ConfigProperties lists, by node type, the properties holding the ID of a
+// config node, for the core nodes and common dashboard nodes. Config nodes
+// are either scoped to a tab, in FlowDefinition.Configs, or shared by all
+// tabs, in the Configs of the global flow.
+var ConfigProperties = map[string][]string{
+	"mqtt in":          {"broker"},
+	"mqtt out":         {"broker"},
+	"mqtt-broker":      {"tls"},
+	"http request":     {"tls", "proxy"},
+	"websocket in":     {"server", "client"},
+	"websocket out":    {"server", "client"},
+	"websocket-client": {"tls", "proxy"},
+	"ui_group":         {"tab"},
+	"ui_button":        {"group"},
+	"ui_chart":         {"group"},
+	"ui_dropdown":      {"group"},
+	"ui_form":          {"group"},
+	"ui_gauge":         {"group"},
+	"ui_slider":        {"group"},
+	"ui_switch":        {"group"},
+	"ui_template":      {"group"},
+	"ui_text":          {"group"},
+	"ui_text_input":    {"group"},
+}
+
+// ConfigReference is a property of a node that refers to a config node
+type ConfigReference struct {
+	Property string
+	ConfigID string
+}
+
+// ConfigReferences returns the config nodes a node refers to through the
+// properties listed in ConfigProperties. Unset properties are skipped.
+func ConfigReferences(node Node) []ConfigReference {
+	var refs []ConfigReference
+	for _, property := range ConfigProperties[node.Type] {
+		if id, ok := node.Properties[property].(string); ok && id != "" {
+			refs = append(refs, ConfigReference{Property: property, ConfigID: id})
+		}
+	}
+	return refs
+}
+
+// GlobalFlow returns the global flow holding config nodes shared by all tabs.
+// Deploying it replaces every global config node and subflow.
+func GlobalFlow(configs ...Node) *FlowDefinition {
+	return &FlowDefinition{ID: GlobalFlowID, Nodes: []Node{}, Configs: configs}
+}
@@ -0,0 +1,181 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConnectionsFromWires lists the wires of the nodes as connections, in node
+// order and then by output port. Node-RED nodes have a single input, so
+// TargetPort is always 0.
+func ConnectionsFromWires(nodes []Node) []Connection {
+	var connections []Connection
+	for _, node := range nodes {
+		for port, targets := range node.Wires {
+			for _, target := range targets {
+				connections = append(connections, Connection{
+					Source:     node.ID,
+					Target:     target,
+					SourcePort: port,
+				})
+			}
+		}
+	}
+	return connections
+}
+
+// Reconciled returns a copy of the flow in which Connections and the nodes'
+// Wires describe the same graph. Connections and Wires are two views of the
+// wiring: a node without wires takes them from the connections leaving it,
+// and Connections is rebuilt from the resulting wires. A node whose wires and
+// connections are both set but differ is a conflict, and so is a wired node
+// without connections when the flow has any; it keeps its wires and a
+// *ConnectionConflictError naming it is returned together with the copy.
+func (f *FlowDefinition) Reconciled() (*FlowDefinition, error) {
+	reconciled := *f
+	reconciled.Nodes = make([]Node, len(f.Nodes))
+	copy(reconciled.Nodes, f.Nodes)
+
+	fromConnections, invalid := connectionWires(f.Connections)
+	conflicts := &ConnectionConflictError{FlowID: f.ID, Conflicts: invalid}
+
+	known := make(map[string]bool, len(f.Nodes))
+	for i, node := range reconciled.Nodes {
+		known[node.ID] = true
+
+		wires, ok := fromConnections[node.ID]
+		if !ok {
+			if len(f.Connections) > 0 && hasWires(node.Wires) {
+				conflicts.add(node.ID, "wires %v have no matching connections", node.Wires)
+			}
+			continue
+		}
+		if !hasWires(node.Wires) {
+			for len(wires) < len(node.Wires) {
+				wires = append(wires, []string{})
+			}
+			reconciled.Nodes[i].Wires = wires
+			continue
+		}
+		if !sameWires(node.Wires, wires) {
+			conflicts.add(node.ID, "wires %v differ from connections %v", node.Wires, wires)
+		}
+	}
+
+	for _, connection := range f.Connections {
+		if !known[connection.Source] {
+			conflicts.add(connection.Source, "connection to %s starts at a node that is not in the flow", connection.Target)
+		}
+	}
+
+	reconciled.Connections = ConnectionsFromWires(reconciled.Nodes)
+
+	if len(conflicts.Conflicts) > 0 {
+		return &reconciled, conflicts
+	}
+	return &reconciled, nil
+}
+
+// ConnectionConflictError is returned by Reconciled when Connections and Wires
+// disagree. It matches ErrConnectionConflict with errors.Is.
+type ConnectionConflictError struct {
+	FlowID    string
+	Conflicts []ConnectionConflict
+}
+
+// ConnectionConflict is a node whose wiring could not be reconciled
+type ConnectionConflict struct {
+	NodeID string
+	Reason string
+}
+
+func (e *ConnectionConflictError) Error() string {
+	reasons := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		reasons[i] = fmt.Sprintf("node %s: %s", conflict.NodeID, conflict.Reason)
+	}
+	return fmt.Sprintf("%s in flow %s: %s", ErrConnectionConflict, e.FlowID, strings.Join(reasons, "; "))
+}
+
+func (e *ConnectionConflictError) add(nodeID, format string, args ...interface{}) {
+	e.Conflicts = append(e.Conflicts, ConnectionConflict{NodeID: nodeID, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Unwrap makes errors.Is(err, ErrConnectionConflict) hold
+func (e *ConnectionConflictError) Unwrap() error {
+	return ErrConnectionConflict
+}
+
+// connectionWires groups connections into per-source wires. Connections to
+// an input other than 0 cannot be expressed as wires and are reported.
+func connectionWires(connections []Connection) (map[string][][]string, []ConnectionConflict) {
+	wires := make(map[string][][]string)
+	var invalid []ConnectionConflict
+
+	for _, connection := range connections {
+		if connection.TargetPort != 0 {
+			invalid = append(invalid, ConnectionConflict{
+				NodeID: connection.Source,
+				Reason: fmt.Sprintf("connection to %s targets input %d, but nodes have a single input", connection.Target, connection.TargetPort),
+			})
+			continue
+		}
+		if connection.SourcePort < 0 {
+			invalid = append(invalid, ConnectionConflict{
+				NodeID: connection.Source,
+				Reason: fmt.Sprintf("connection to %s has negative source port %d", connection.Target, connection.SourcePort),
+			})
+			continue
+		}
+
+		ports := wires[connection.Source]
+		for len(ports) <= connection.SourcePort {
+			ports = append(ports, []string{})
+		}
+		ports[connection.SourcePort] = append(ports[connection.SourcePort], connection.Target)
+		wires[connection.Source] = ports
+	}
+
+	return wires, invalid
+}
+
+// hasWires reports whether any output port is wired
+func hasWires(wires [][]string) bool {
+	for _, targets := range wires {
+		if len(targets) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sameWires compares wires port by port, ignoring the order of targets and
+// trailing unwired ports
+func sameWires(a, b [][]string) bool {
+	ports := len(a)
+	if len(b) > ports {
+		ports = len(b)
+	}
+
+	for port := 0; port < ports; port++ {
+		var x, y []string
+		if port < len(a) {
+			x = append(x, a[port]...)
+		}
+		if port < len(b) {
+			y = append(y, b[port]...)
+		}
+		if len(x) != len(y) {
+			return false
+		}
+		sort.Strings(x)
+		sort.Strings(y)
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
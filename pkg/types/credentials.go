@@ -0,0 +1,58 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CredentialPlaceholder stands for a credential Node-RED holds but never
+// returns. Nodes read back carry it for each has_<field> mark, and sending it
+// keeps the stored value.
+const CredentialPlaceholder = "__PWRD__"
+
+// Credentials are the secrets of a node, such as passwords and tokens, keyed
+// by field. Node-RED stores them apart from the flow and does not return
+// them, so they are write-only: a node deployed without Credentials keeps
+// the ones Node-RED has. Their values never appear when the credentials are
+// printed or marshalled to JSON.
+type Credentials map[string]string
+
+// Has reports whether a credential is set, with a value or as a placeholder
+func (c Credentials) Has(field string) bool {
+	_, ok := c[field]
+	return ok
+}
+
+// Fields returns the names of the credentials that are set, sorted
+func (c Credentials) Fields() []string {
+	fields := make([]string, 0, len(c))
+	for field := range c {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// String lists the fields without their values
+func (c Credentials) String() string {
+	return fmt.Sprintf("credentials[%s]", strings.Join(c.Fields(), " "))
+}
+
+// GoString keeps %#v from printing the values
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+// MarshalJSON writes the fields with their values redacted
+func (c Credentials) MarshalJSON() ([]byte, error) {
+	if c == nil {
+		return []byte("null"), nil
+	}
+	masked := make(map[string]string, len(c))
+	for field := range c {
+		masked[field] = "[REDACTED]"
+	}
+	return json.Marshal(masked)
+}
@@ -0,0 +1,107 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// EnvType is the type of an environment variable, which tells Node-RED how to
+// read its value
+type EnvType string
+
+const (
+	// EnvString is a plain string
+	EnvString EnvType = "str"
+	// EnvNumber is a number, e.g. "42" or "0.5"
+	EnvNumber EnvType = "num"
+	// EnvBool is "true" or "false"
+	EnvBool EnvType = "bool"
+	// EnvJSON is a JSON document, parsed when the variable is read
+	EnvJSON EnvType = "json"
+	// EnvRef takes its value from the environment variable it names, either
+	// one of an enclosing flow or one of the Node-RED process
+	EnvRef EnvType = "env"
+	// EnvCredential is a secret. Node-RED keeps its value with the
+	// credentials of the tab or subflow and never returns it, so a variable
+	// deployed without a value keeps the one Node-RED has.
+	EnvCredential EnvType = "cred"
+)
+
+// Known reports whether t is one of the types above. Node-RED has a few more,
+// such as "jsonata", which are deployed as they are but never checked.
+func (t EnvType) Known() bool {
+	switch t {
+	case EnvString, EnvNumber, EnvBool, EnvJSON, EnvRef, EnvCredential:
+		return true
+	default:
+		return false
+	}
+}
+
+// EnvVar is an environment variable defined on a tab, a subflow template or a
+// subflow instance. Nodes read it as ${NAME} in their properties or with
+// env.get in function nodes.
+type EnvVar struct {
+	Name  string  `json:"name"`
+	Value string  `json:"value"`
+	Type  EnvType `json:"type"`
+}
+
+// envName is the form the Node-RED editor accepts for variable names
+var envName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Validate checks the name and that the value suits the type. Variables of
+// types that are not Known are not checked.
+func (e EnvVar) Validate() error {
+	if !envName.MatchString(e.Name) {
+		return fmt.Errorf("invalid env var name %q", e.Name)
+	}
+	switch e.Type {
+	case EnvNumber:
+		if _, err := strconv.ParseFloat(e.Value, 64); err != nil {
+			return fmt.Errorf("env var %s: %q is not a number", e.Name, e.Value)
+		}
+	case EnvBool:
+		if e.Value != "true" && e.Value != "false" {
+			return fmt.Errorf("env var %s: %q is not true or false", e.Name, e.Value)
+		}
+	case EnvJSON:
+		if !json.Valid([]byte(e.Value)) {
+			return fmt.Errorf("env var %s: value is not valid JSON", e.Name)
+		}
+	case EnvRef:
+		if e.Value == "" {
+			return fmt.Errorf("env var %s: refers to no variable", e.Name)
+		}
+	}
+	return nil
+}
+
+// String renders the variable, hiding the value of a credential
+func (e EnvVar) String() string {
+	value := e.Value
+	if e.Type == EnvCredential {
+		value = "[REDACTED]"
+	}
+	return fmt.Sprintf("%s=%s (%s)", e.Name, value, e.Type)
+}
+
+// GoString keeps %#v from printing the value of a credential
+func (e EnvVar) GoString() string {
+	return e.String()
+}
+
+// MarshalJSON leaves out the value of a credential, as Node-RED does when it
+// returns one
+func (e EnvVar) MarshalJSON() ([]byte, error) {
+	type plain EnvVar
+	if e.Type != EnvCredential {
+		return json.Marshal(plain(e))
+	}
+	return json.Marshal(struct {
+		Name string  `json:"name"`
+		Type EnvType `json:"type"`
+	}{e.Name, e.Type})
+}
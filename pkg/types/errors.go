@@ -0,0 +1,98 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrConflict is returned when Node-RED rejects a deploy because the flows were
+// changed since the revision the deploy was based on. Re-read the flows and retry.
+var ErrConflict = errors.New("flow revision conflict")
+
+// ErrCircuitOpen is returned without contacting Node-RED while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrStrategyAuth is returned when Node-RED only allows logging in through a
+// browser-based strategy (OAuth, SSO), so no token can be obtained with a
+// username and password. Use a token issued out of band as the API key instead.
+var ErrStrategyAuth = errors.New("node-red requires strategy-based login")
+
+// ErrNotFound matches any 404 response from Node-RED
+var ErrNotFound = errors.New("not found")
+
+// ErrFlowNotFound is returned when the requested flow does not exist
+var ErrFlowNotFound = errors.New("flow not found")
+
+// ErrUnauthorized is returned when Node-RED rejects the access token, or none was sent
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrForbidden is returned when the access token lacks the scope for the request
+var ErrForbidden = errors.New("forbidden")
+
+// ErrUnavailable is returned when Node-RED cannot be reached or answers with a
+// server error, typically because it is down or restarting
+var ErrUnavailable = errors.New("node-red unavailable")
+
+// ErrInvalidFlow is returned when a flow fails validation before it is deployed
+var ErrInvalidFlow = errors.New("invalid flow")
+
+// ErrConnectionConflict is returned when a flow's Connections and its nodes'
+// Wires describe different wiring
+var ErrConnectionConflict = errors.New("connections conflict with wires")
+
+// APIError is a non-successful response from the Node-RED admin API. Use
+// errors.Is with the sentinel errors above to classify it, or errors.As to
+// inspect the response.
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	// Code and Message come from Node-RED's {"code": ..., "message": ...} error
+	// body, when the response has one
+	Code    string
+	Message string
+	// Body is the raw response body
+	Body string
+	// Err is a more specific cause, such as ErrFlowNotFound
+	Err error
+}
+
+// Error describes the request and what Node-RED answered
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: status %d", e.Method, e.URL, e.StatusCode)
+	switch {
+	case e.Code != "" && e.Message != "":
+		msg += fmt.Sprintf(": %s: %s", e.Code, e.Message)
+	case e.Message != "":
+		msg += ": " + e.Message
+	case e.Code != "":
+		msg += ": " + e.Code
+	case e.Body != "":
+		msg += ", body: " + e.Body
+	}
+	return msg
+}
+
+// Unwrap returns the specific cause, if any
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is classifies the error by status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnavailable:
+		return e.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
@@ -0,0 +1,114 @@
+package types
+
+import "strings"
+
+// SubflowPrefix starts the type of nodes instantiating a subflow
+const SubflowPrefix = "subflow:"
+
+// SubflowDefinition is a subflow template: a group of nodes that flows use
+// like a single node, through instance nodes of type "subflow:<ID>". Its
+// nodes are wired to the template's input and outputs through In and Out.
+type SubflowDefinition struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Info     string `json:"info,omitempty"`
+	Category string `json:"category,omitempty"`
+	// In is empty for a subflow without input, or holds its single input
+	In  []SubflowPort `json:"in"`
+	Out []SubflowPort `json:"out"`
+	// Env declares the subflow's properties and their defaults, which each
+	// instance may override
+	Env     []EnvVar `json:"env,omitempty"`
+	Nodes   []Node   `json:"nodes"`
+	Configs []Node   `json:"configs,omitempty"`
+	// Properties holds any other template keys, e.g. color, icon or status
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// SubflowPort is the input or an output of a subflow template
+type SubflowPort struct {
+	Position Position      `json:"position"`
+	Wires    []SubflowWire `json:"wires"`
+}
+
+// SubflowWire connects a subflow port to a node inside the subflow: the node
+// the input feeds, or the node and output port feeding an output
+type SubflowWire struct {
+	ID   string `json:"id"`
+	Port int    `json:"port,omitempty"`
+}
+
+// InstanceType is the node type of the subflow's instances
+func (s *SubflowDefinition) InstanceType() string {
+	return SubflowPrefix + s.ID
+}
+
+// Instance returns a node instantiating the subflow. Env overrides the
+// defaults of the subflow's properties for this instance.
+func (s *SubflowDefinition) Instance(id string, env ...EnvVar) Node {
+	node := Node{
+		ID:    id,
+		Type:  s.InstanceType(),
+		Wires: make([][]string, len(s.Out)),
+	}
+	for i := range node.Wires {
+		node.Wires[i] = []string{}
+	}
+	if len(env) > 0 {
+		node.Properties = map[string]interface{}{"env": env}
+	}
+	return node
+}
+
+// SubflowID returns the ID of the subflow a node instantiates, if it is a
+// subflow instance
+func SubflowID(node Node) (string, bool) {
+	return strings.CutPrefix(node.Type, SubflowPrefix)
+}
+
+// SubflowDependencies returns the IDs of the subflows whose instances the
+// nodes contain, in node order
+func SubflowDependencies(nodes []Node) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		if id, ok := SubflowID(node); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// OrderSubflows returns the subflows ordered so that every subflow comes after
+// the subflows it instantiates, keeping the given order otherwise. Node-RED
+// needs a template to exist before its instances are created. Subflows that
+// instantiate each other keep their given order.
+func OrderSubflows(subflows []SubflowDefinition) []SubflowDefinition {
+	byID := make(map[string]int, len(subflows))
+	for i, subflow := range subflows {
+		byID[subflow.ID] = i
+	}
+
+	ordered := make([]SubflowDefinition, 0, len(subflows))
+	state := make(map[string]int) // 1 while visiting, 2 once added
+	var visit func(i int)
+	visit = func(i int) {
+		id := subflows[i].ID
+		if state[id] != 0 {
+			return
+		}
+		state[id] = 1
+		for _, dep := range SubflowDependencies(subflows[i].Nodes) {
+			if j, ok := byID[dep]; ok {
+				visit(j)
+			}
+		}
+		state[id] = 2
+		ordered = append(ordered, subflows[i])
+	}
+	for i := range subflows {
+		visit(i)
+	}
+	return ordered
+}
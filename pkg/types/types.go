@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"time"
 )
 
@@ -13,13 +14,52 @@ type FlowDefinition struct {
 	Description string                 `json:"description,omitempty"`
 	Info        string                 `json:"info,omitempty"`
 	Disabled    bool                   `json:"disabled"`
+	Env         []EnvVar               `json:"env,omitempty"`
 	Nodes       []Node                 `json:"nodes"`
+	Configs     []Node                 `json:"configs,omitempty"` // Config nodes scoped to this tab; shared ones belong to the global flow
+	Subflows    []SubflowDefinition    `json:"subflows,omitempty"`
 	Connections []Connection           `json:"connections,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt   time.Time              `json:"created_at,omitempty"`
 	UpdatedAt   time.Time              `json:"updated_at,omitempty"`
 }
 
+// GlobalFlowID is the ID Node-RED uses for the global flow, which holds the
+// config nodes and subflows that are not on any tab. It has no nodes.
+const GlobalFlowID = "global"
+
+// FlowConfig is the complete flow configuration of a Node-RED instance as
+// returned by GET /flows, together with its revision
+type FlowConfig struct {
+	Rev   string                   `json:"rev"`
+	Flows []map[string]interface{} `json:"flows"`
+}
+
+// DeploymentType is the Node-RED-Deployment-Type of a full configuration deploy
+type DeploymentType string
+
+const (
+	// DeployFull stops and restarts every node
+	DeployFull DeploymentType = "full"
+	// DeployNodes only restarts the nodes that changed
+	DeployNodes DeploymentType = "nodes"
+	// DeployFlows only restarts the flows (tabs) containing changed nodes
+	DeployFlows DeploymentType = "flows"
+	// DeployReload restarts all flows from storage without deploying new ones
+	DeployReload DeploymentType = "reload"
+)
+
+// Valid reports whether t is a known deployment type. The empty value is
+// valid and leaves the choice to Node-RED, which defaults to a full deploy.
+func (t DeploymentType) Valid() bool {
+	switch t {
+	case "", DeployFull, DeployNodes, DeployFlows, DeployReload:
+		return true
+	default:
+		return false
+	}
+}
+
 // Node represents a Node-RED node
 type Node struct {
 	ID         string                 `json:"id"`
@@ -28,6 +68,8 @@ type Node struct {
 	Position   Position               `json:"position"`
 	Properties map[string]interface{} `json:"properties"`
 	Wires      [][]string             `json:"wires"`
+	// Credentials are sent in the node's credentials on deploy
+	Credentials Credentials `json:"credentials,omitempty"`
 }
 
 // Connection represents a connection between nodes
@@ -64,18 +106,99 @@ type LogEntry struct {
 
 // Config holds configuration for the Node-RED wrapper
 type Config struct {
-	NodeRedURL    string        `yaml:"node_red_url" json:"node_red_url"`
-	APIKey        string        `yaml:"api_key" json:"api_key"`
-	Timeout       time.Duration `yaml:"timeout" json:"timeout"`
-	RetryAttempts int           `yaml:"retry_attempts" json:"retry_attempts"`
-	Debug         bool          `yaml:"debug" json:"debug"`
+	NodeRedURL     string            `yaml:"node_red_url" json:"node_red_url"`
+	HTTPNodeURL    string            `yaml:"http_node_url" json:"http_node_url,omitempty"` // Base URL for http in routes, defaults to NodeRedURL
+	APIKey         string            `yaml:"api_key" json:"api_key"`
+	ClientID       string            `yaml:"client_id" json:"client_id,omitempty"` // OAuth client ID used to log in, defaults to node-red-admin
+	Scope          string            `yaml:"scope" json:"scope,omitempty"`         // Token scope requested on login, e.g. "read"; defaults to "*"
+	Timeout        time.Duration     `yaml:"timeout" json:"timeout"`
+	RetryAttempts  int               `yaml:"retry_attempts" json:"retry_attempts"`
+	RetryPolicy    *RetryPolicy      `yaml:"retry_policy" json:"retry_policy,omitempty"`
+	CircuitBreaker *CircuitBreaker   `yaml:"circuit_breaker" json:"circuit_breaker,omitempty"`
+	Debug          bool              `yaml:"debug" json:"debug"`
+	Logging        *Logging          `yaml:"logging" json:"logging,omitempty"`
+	Execution      *ExecutionOptions `yaml:"execution" json:"execution,omitempty"` // Defaults applied to ExecuteFlow
+	Monitoring     *Monitoring       `yaml:"monitoring" json:"monitoring,omitempty"`
+	Logger         Logger            `yaml:"-" json:"-"` // Overrides Logging; defaults to a log/slog logger on stderr
 }
 
+// ConfigChange describes a configuration applied to a running wrapper
+type ConfigChange struct {
+	Previous *Config   `json:"previous"`
+	Current  *Config   `json:"current"`
+	Time     time.Time `json:"time"`
+}
+
+// Monitoring configures health checking and metrics
+type Monitoring struct {
+	Enabled             bool          `yaml:"enabled" json:"enabled"`
+	MetricsPort         int           `yaml:"metrics_port" json:"metrics_port"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" json:"health_check_interval"`
+}
+
+// Logging configures the default logger
+type Logging struct {
+	Level  string `yaml:"level" json:"level"`   // debug, info, warn, error; defaults to warn
+	Format string `yaml:"format" json:"format"` // json or text; defaults to text
+}
+
+// Logger receives leveled, structured log events as alternating key/value
+// pairs. *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// AuthToken is an admin API access token issued by Node-RED
+type AuthToken struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"` // Zero for tokens that do not expire, such as a static API key
+}
+
+// AuthScheme is the admin authentication method a Node-RED instance uses
+type AuthScheme string
+
+const (
+	// AuthNone means the admin API is open and needs no token
+	AuthNone AuthScheme = ""
+	// AuthCredentials is username/password login exchanged for a token
+	AuthCredentials AuthScheme = "credentials"
+	// AuthStrategy is a Passport strategy (OAuth, SSO) completed in a browser
+	AuthStrategy AuthScheme = "strategy"
+)
+
+// AuthInfo describes how to log in to Node-RED, as advertised by GET /auth/login
+type AuthInfo struct {
+	Type    AuthScheme   `json:"type,omitempty"`
+	Prompts []AuthPrompt `json:"prompts,omitempty"`
+}
+
+// AuthPrompt is a single login prompt: an input field for credentials login,
+// or a login button with its URL for strategy login
+type AuthPrompt struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Label string `json:"label,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// CredentialsFunc supplies the username and password used to re-authenticate
+// when the access token expires, e.g. by reading them from a secret store
+type CredentialsFunc func(ctx context.Context) (username, password string, err error)
+
 // ExecutionOptions holds options for flow execution
 type ExecutionOptions struct {
-	Timeout     time.Duration `yaml:"timeout" json:"timeout"`
-	Async       bool          `yaml:"async" json:"async"`
-	RetryPolicy *RetryPolicy  `yaml:"retry_policy" json:"retry_policy"`
+	// Timeout bounds each execution, replacing Config.Timeout, which only
+	// applies to admin API requests
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	// RetryPolicy is for callers retrying executions themselves; ExecuteFlow
+	// never retries, and Config.RetryPolicy does not apply to executions
+	RetryPolicy *RetryPolicy `yaml:"retry_policy" json:"retry_policy"`
 }
 
 // RetryPolicy defines retry behavior
@@ -86,11 +209,46 @@ type RetryPolicy struct {
 	BackoffFactor float64       `yaml:"backoff_factor" json:"backoff_factor"`
 }
 
-// CircuitBreaker defines circuit breaker behavior
+// CircuitBreaker defines circuit breaker behavior.
+// After MaxFailures consecutive failures the breaker opens and rejects calls
+// for Timeout before letting a single probe through. ResetTimeout is the window
+// after which an old run of failures is forgotten.
 type CircuitBreaker struct {
 	MaxFailures  int           `yaml:"max_failures" json:"max_failures"`
 	Timeout      time.Duration `yaml:"timeout" json:"timeout"`
 	ResetTimeout time.Duration `yaml:"reset_timeout" json:"reset_timeout"`
+	PerEndpoint  bool          `yaml:"per_endpoint" json:"per_endpoint"`
+}
+
+// CircuitState represents the state of a circuit breaker
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the name of the circuit state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitStateChange describes a circuit breaker state transition
+type CircuitStateChange struct {
+	Endpoint string       `json:"endpoint"`
+	From     CircuitState `json:"from"`
+	To       CircuitState `json:"to"`
+	Time     time.Time    `json:"time"`
 }
 
 // HealthStatus represents the health status of a component
@@ -0,0 +1,389 @@
+package wrapper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// DefaultTimeout is the request timeout used when the config does not set one
+const DefaultTimeout = 30 * time.Second
+
+// EnvPrefix is the prefix of the environment variables overlaid by LoadConfig
+const EnvPrefix = "NODERED_"
+
+// fileConfig mirrors the layout of configs/config.yaml
+type fileConfig struct {
+	NodeRed struct {
+		URL           string   `yaml:"url"`
+		APIKey        string   `yaml:"api_key"`
+		ClientID      string   `yaml:"client_id"`
+		Scope         string   `yaml:"scope"`
+		HTTPNodeURL   string   `yaml:"http_node_url"`
+		Timeout       duration `yaml:"timeout"`
+		RetryAttempts int      `yaml:"retry_attempts"`
+	} `yaml:"node_red"`
+
+	// RetryPolicy applies to Node-RED admin API requests
+	RetryPolicy *fileRetryPolicy `yaml:"retry_policy"`
+
+	Debug bool `yaml:"debug"`
+
+	Logging *types.Logging `yaml:"logging"`
+
+	Monitoring *struct {
+		Enabled             bool     `yaml:"enabled"`
+		MetricsPort         int      `yaml:"metrics_port"`
+		HealthCheckInterval duration `yaml:"health_check_interval"`
+	} `yaml:"monitoring"`
+
+	Execution *struct {
+		DefaultTimeout duration         `yaml:"default_timeout"`
+		RetryPolicy    *fileRetryPolicy `yaml:"retry_policy"`
+	} `yaml:"execution"`
+
+	CircuitBreaker *struct {
+		MaxFailures  int      `yaml:"max_failures"`
+		Timeout      duration `yaml:"timeout"`
+		ResetTimeout duration `yaml:"reset_timeout"`
+		PerEndpoint  bool     `yaml:"per_endpoint"`
+	} `yaml:"circuit_breaker"`
+}
+
+type fileRetryPolicy struct {
+	MaxRetries    int      `yaml:"max_retries"`
+	InitialDelay  duration `yaml:"initial_delay"`
+	MaxDelay      duration `yaml:"max_delay"`
+	BackoffFactor float64  `yaml:"backoff_factor"`
+}
+
+func (rp *fileRetryPolicy) toRetryPolicy() *types.RetryPolicy {
+	if rp == nil {
+		return nil
+	}
+	return &types.RetryPolicy{
+		MaxRetries:    rp.MaxRetries,
+		InitialDelay:  time.Duration(rp.InitialDelay),
+		MaxDelay:      time.Duration(rp.MaxDelay),
+		BackoffFactor: rp.BackoffFactor,
+	}
+}
+
+// duration accepts Go duration strings such as "30s" or "5m"
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Value == "" {
+		*d = 0
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q (use a unit, e.g. \"30s\")", node.Line, node.Value)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// LoadConfig reads a config file laid out like configs/config.yaml, overlays
+// NODERED_* environment variables and validates the result. With an empty
+// path the config is built from the environment alone.
+func LoadConfig(path string) (*types.Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+	}
+
+	config, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if err := applyEnv(config, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	applyConfigDefaults(config)
+
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ParseConfig parses YAML laid out like configs/config.yaml, without looking
+// at the environment, and validates it
+func ParseConfig(data []byte) (*types.Config, error) {
+	config, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	applyConfigDefaults(config)
+
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// parseConfig maps the file layout onto types.Config
+func parseConfig(data []byte) (*types.Config, error) {
+	var file fileConfig
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	config := &types.Config{
+		NodeRedURL:    file.NodeRed.URL,
+		HTTPNodeURL:   file.NodeRed.HTTPNodeURL,
+		APIKey:        file.NodeRed.APIKey,
+		ClientID:      file.NodeRed.ClientID,
+		Scope:         file.NodeRed.Scope,
+		Timeout:       time.Duration(file.NodeRed.Timeout),
+		RetryAttempts: file.NodeRed.RetryAttempts,
+		Debug:         file.Debug,
+		Logging:       file.Logging,
+	}
+
+	if m := file.Monitoring; m != nil {
+		config.Monitoring = &types.Monitoring{
+			Enabled:             m.Enabled,
+			MetricsPort:         m.MetricsPort,
+			HealthCheckInterval: time.Duration(m.HealthCheckInterval),
+		}
+	}
+
+	if e := file.Execution; e != nil {
+		config.Execution = &types.ExecutionOptions{
+			Timeout: time.Duration(e.DefaultTimeout),
+		}
+		config.Execution.RetryPolicy = e.RetryPolicy.toRetryPolicy()
+	}
+	config.RetryPolicy = file.RetryPolicy.toRetryPolicy()
+
+	if cb := file.CircuitBreaker; cb != nil {
+		config.CircuitBreaker = &types.CircuitBreaker{
+			MaxFailures:  cb.MaxFailures,
+			Timeout:      time.Duration(cb.Timeout),
+			ResetTimeout: time.Duration(cb.ResetTimeout),
+			PerEndpoint:  cb.PerEndpoint,
+		}
+	}
+
+	return config, nil
+}
+
+// applyEnv overlays NODERED_* environment variables onto the config
+func applyEnv(config *types.Config, lookup func(string) (string, bool)) error {
+	env := func(name string) (string, bool) {
+		value, ok := lookup(EnvPrefix + name)
+		return strings.TrimSpace(value), ok
+	}
+	var errs []string
+	parseDuration := func(name string, target *time.Duration) {
+		if value, ok := env(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s%s: invalid duration %q", EnvPrefix, name, value))
+				return
+			}
+			*target = d
+		}
+	}
+	parseInt := func(name string, target *int) {
+		if value, ok := env(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s%s: invalid integer %q", EnvPrefix, name, value))
+				return
+			}
+			*target = n
+		}
+	}
+	parseBool := func(name string, target *bool) {
+		if value, ok := env(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s%s: invalid boolean %q", EnvPrefix, name, value))
+				return
+			}
+			*target = b
+		}
+	}
+	parseString := func(name string, target *string) {
+		if value, ok := env(name); ok {
+			*target = value
+		}
+	}
+
+	parseString("URL", &config.NodeRedURL)
+	parseString("HTTP_NODE_URL", &config.HTTPNodeURL)
+	parseString("API_KEY", &config.APIKey)
+	parseString("CLIENT_ID", &config.ClientID)
+	parseString("SCOPE", &config.Scope)
+	parseDuration("TIMEOUT", &config.Timeout)
+	parseInt("RETRY_ATTEMPTS", &config.RetryAttempts)
+	parseBool("DEBUG", &config.Debug)
+
+	if _, ok := env("LOG_LEVEL"); ok && config.Logging == nil {
+		config.Logging = &types.Logging{}
+	}
+	if _, ok := env("LOG_FORMAT"); ok && config.Logging == nil {
+		config.Logging = &types.Logging{}
+	}
+	if config.Logging != nil {
+		parseString("LOG_LEVEL", &config.Logging.Level)
+		parseString("LOG_FORMAT", &config.Logging.Format)
+	}
+
+	if _, ok := env("EXECUTION_TIMEOUT"); ok && config.Execution == nil {
+		config.Execution = &types.ExecutionOptions{}
+	}
+	if config.Execution != nil {
+		parseDuration("EXECUTION_TIMEOUT", &config.Execution.Timeout)
+	}
+
+	if _, ok := env("CIRCUIT_BREAKER_MAX_FAILURES"); ok && config.CircuitBreaker == nil {
+		config.CircuitBreaker = &types.CircuitBreaker{}
+	}
+	if config.CircuitBreaker != nil {
+		parseInt("CIRCUIT_BREAKER_MAX_FAILURES", &config.CircuitBreaker.MaxFailures)
+		parseDuration("CIRCUIT_BREAKER_TIMEOUT", &config.CircuitBreaker.Timeout)
+		parseDuration("CIRCUIT_BREAKER_RESET_TIMEOUT", &config.CircuitBreaker.ResetTimeout)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// applyConfigDefaults fills in settings the config leaves unset
+func applyConfigDefaults(config *types.Config) {
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+}
+
+// ValidateConfig checks a config for values Node-RED calls cannot work with,
+// reporting every problem found
+func ValidateConfig(config *types.Config) error {
+	if config == nil {
+		return fmt.Errorf("config is required")
+	}
+
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if config.NodeRedURL == "" {
+		add("node_red.url is required")
+	} else if err := validateURL(config.NodeRedURL); err != nil {
+		add("node_red.url: %v", err)
+	}
+	if config.HTTPNodeURL != "" {
+		if err := validateURL(config.HTTPNodeURL); err != nil {
+			add("node_red.http_node_url: %v", err)
+		}
+	}
+	if config.Timeout <= 0 {
+		add("node_red.timeout must be positive, got %s", config.Timeout)
+	}
+	if config.RetryAttempts < 0 {
+		add("node_red.retry_attempts must not be negative, got %d", config.RetryAttempts)
+	}
+
+	validateRetryPolicy("retry_policy", config.RetryPolicy, add)
+
+	if e := config.Execution; e != nil {
+		if e.Timeout < 0 {
+			add("execution.default_timeout must not be negative, got %s", e.Timeout)
+		}
+		validateRetryPolicy("execution.retry_policy", e.RetryPolicy, add)
+	}
+
+	if cb := config.CircuitBreaker; cb != nil {
+		if cb.MaxFailures < 0 {
+			add("circuit_breaker.max_failures must not be negative, got %d", cb.MaxFailures)
+		}
+		if cb.Timeout < 0 || cb.ResetTimeout < 0 {
+			add("circuit_breaker timeouts must not be negative")
+		}
+	}
+
+	if l := config.Logging; l != nil {
+		switch strings.ToLower(l.Level) {
+		case "", "debug", "info", "warn", "error":
+		default:
+			add("logging.level must be debug, info, warn or error, got %q", l.Level)
+		}
+		switch strings.ToLower(l.Format) {
+		case "", "json", "text":
+		default:
+			add("logging.format must be json or text, got %q", l.Format)
+		}
+	}
+
+	if m := config.Monitoring; m != nil {
+		if m.MetricsPort < 0 || m.MetricsPort > 65535 {
+			add("monitoring.metrics_port must be a valid port, got %d", m.MetricsPort)
+		}
+		if m.HealthCheckInterval < 0 {
+			add("monitoring.health_check_interval must not be negative, got %s", m.HealthCheckInterval)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateRetryPolicy reports the problems of a retry policy found under key
+func validateRetryPolicy(key string, rp *types.RetryPolicy, add func(format string, args ...interface{})) {
+	if rp == nil {
+		return
+	}
+	if rp.MaxRetries < 0 {
+		add("%s.max_retries must not be negative, got %d", key, rp.MaxRetries)
+	}
+	if rp.InitialDelay < 0 || rp.MaxDelay < 0 {
+		add("%s delays must not be negative", key)
+	}
+	if rp.MaxDelay > 0 && rp.MaxDelay < rp.InitialDelay {
+		add("%s.max_delay %s is shorter than initial_delay %s", key, rp.MaxDelay, rp.InitialDelay)
+	}
+	if rp.BackoffFactor != 0 && rp.BackoffFactor < 1 {
+		add("%s.backoff_factor must be at least 1, got %g", key, rp.BackoffFactor)
+	}
+}
+
+// validateURL requires an absolute http or https URL
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in %q", raw)
+	}
+	return nil
+}
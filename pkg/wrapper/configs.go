@@ -0,0 +1,169 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// ConfigOwnerProperty is the property recording which owner manages a global
+// config node. Node-RED keeps it as long as the node is not edited in the
+// editor, which drops properties it does not know; such nodes are no longer
+// considered owned and are never collected.
+const ConfigOwnerProperty = "yoyoOwner"
+
+// DeployGlobalConfigs adds or updates global config nodes, shared by all
+// tabs, on behalf of an owner. The other global config nodes and subflows are
+// kept. A config node whose ID is taken by a node of another owner, or one
+// created in the editor, is an error. Global config nodes the owner no longer
+// deploys stay until CollectConfigs finds them unused.
+//
+// Node-RED has no revision for the global flow alone, so a change made
+// between reading and writing it is lost.
+func (w *NodeRedWrapper) DeployGlobalConfigs(ctx context.Context, owner string, configs []types.Node) error {
+	if owner == "" {
+		return fmt.Errorf("owner is required")
+	}
+
+	c, done := w.acquire()
+	defer done()
+
+	global, err := c.GetFlow(ctx, types.GlobalFlowID)
+	if err != nil {
+		return fmt.Errorf("failed to read global config nodes: %w", err)
+	}
+
+	index := make(map[string]int, len(global.Configs))
+	for i, config := range global.Configs {
+		index[config.ID] = i
+	}
+	for _, config := range configs {
+		if config.ID == "" {
+			return fmt.Errorf("config node ID is required")
+		}
+		owned := withConfigOwner(config, owner)
+		i, exists := index[config.ID]
+		if !exists {
+			index[config.ID] = len(global.Configs)
+			global.Configs = append(global.Configs, owned)
+			continue
+		}
+		if configOwner(global.Configs[i]) != owner {
+			return fmt.Errorf("config node %s exists but is not managed by %s", config.ID, owner)
+		}
+		global.Configs[i] = owned
+	}
+
+	return c.DeployFlow(ctx, global)
+}
+
+// CollectConfigs removes the global config nodes of an owner that no node in
+// Node-RED refers to any more, returning their IDs. A reference is any
+// property of another node holding the config node's ID, so config nodes used
+// by node types unknown to the wrapper are kept as well. A config node used
+// only by another one being removed goes on the next collection.
+func (w *NodeRedWrapper) CollectConfigs(ctx context.Context, owner string) ([]string, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("owner is required")
+	}
+
+	c, done := w.acquire()
+	defer done()
+
+	global, err := c.GetFlow(ctx, types.GlobalFlowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read global config nodes: %w", err)
+	}
+	candidates := make(map[string]bool)
+	for _, config := range global.Configs {
+		if configOwner(config) == owner {
+			candidates[config.ID] = true
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	nodes, err := c.GetFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flows: %w", err)
+	}
+	for _, node := range nodes {
+		for key, value := range node {
+			if key != "id" {
+				unmarkReferenced(candidates, node["id"], value)
+			}
+		}
+	}
+
+	var removed []string
+	kept := global.Configs[:0]
+	for _, config := range global.Configs {
+		if candidates[config.ID] {
+			removed = append(removed, config.ID)
+			continue
+		}
+		kept = append(kept, config)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	global.Configs = kept
+	if err := c.DeployFlow(ctx, global); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// unmarkReferenced removes every string found in a property value from the
+// candidates, except the ID of the node holding it
+func unmarkReferenced(candidates map[string]bool, self interface{}, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v != self {
+			delete(candidates, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			unmarkReferenced(candidates, self, item)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			unmarkReferenced(candidates, self, item)
+		}
+	}
+}
+
+// configOwner returns the owner recorded on a config node, if any
+func configOwner(node types.Node) string {
+	owner, _ := node.Properties[ConfigOwnerProperty].(string)
+	return owner
+}
+
+// withConfigOwner returns a copy of the config node marked as the owner's
+func withConfigOwner(node types.Node, owner string) types.Node {
+	properties := make(map[string]interface{}, len(node.Properties)+1)
+	for key, value := range node.Properties {
+		properties[key] = value
+	}
+	properties[ConfigOwnerProperty] = owner
+	node.Properties = properties
+	return node
+}
+
+// loadGlobals reads the global config nodes that WithValidation checks
+// references against, unless they were given with WithGlobalConfigs
+func (w *NodeRedWrapper) loadGlobals(ctx context.Context, options *deployOptions) error {
+	if !options.validate || options.globalsKnown {
+		return nil
+	}
+
+	global, err := w.GetFlow(ctx, types.GlobalFlowID)
+	if err != nil {
+		return fmt.Errorf("failed to read global config nodes: %w", err)
+	}
+	options.globals, options.globalsKnown = global.Configs, true
+	return nil
+}
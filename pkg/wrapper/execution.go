@@ -0,0 +1,269 @@
+package wrapper
+
+import (
+	"fmt"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/internal/client"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// ManagedProperty marks nodes the wrapper adds to a flow and owns. They are
+// replaced on every deploy and should not be edited by hand.
+const ManagedProperty = "yoyoManaged"
+
+// ExecutionEndpoint describes where the managed http in / http response pair
+// is wired into a flow
+type ExecutionEndpoint struct {
+	// EntryNodes receive the HTTP request as msg.payload. Defaults to the nodes
+	// wired from inject nodes, or else the nodes without incoming wires.
+	EntryNodes []string
+	// ExitNodes have their first output wired to the http response node.
+	// Defaults to the nodes wired into debug nodes, or else the nodes without
+	// outgoing wires.
+	ExitNodes []string
+}
+
+// sinkTypes are node types with no outputs that cannot feed the http response node
+var sinkTypes = map[string]bool{
+	"debug":         true,
+	"http response": true,
+	"link out":      true,
+	"mqtt out":      true,
+	"comment":       true,
+}
+
+// executionNodeIDs returns the IDs of the managed http in and http response nodes
+func executionNodeIDs(flowID string) (string, string) {
+	return flowID + "-execute-in", flowID + "-execute-out"
+}
+
+// injectExecutionEndpoint returns a copy of the flow with a managed http in /
+// http response pair wired in. Managed nodes from a previous deploy are
+// replaced, so injecting is idempotent. The flow's wires must already be
+// reconciled with its Connections, which are rebuilt from the new wires.
+func injectExecutionEndpoint(flow *types.FlowDefinition, endpoint ExecutionEndpoint) (*types.FlowDefinition, error) {
+	inID, outID := executionNodeIDs(flow.ID)
+	result := withoutManagedNodes(flow)
+
+	entries := endpoint.EntryNodes
+	if len(entries) == 0 {
+		entries = defaultEntryNodes(result.Nodes)
+	}
+	exits := endpoint.ExitNodes
+	if len(exits) == 0 {
+		exits = defaultExitNodes(result.Nodes)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("flow %s has no entry node for the execution endpoint", flow.ID)
+	}
+	if len(exits) == 0 {
+		return nil, fmt.Errorf("flow %s has no exit node for the execution endpoint", flow.ID)
+	}
+
+	index := make(map[string]int, len(result.Nodes))
+	for i, node := range result.Nodes {
+		index[node.ID] = i
+	}
+	for _, id := range entries {
+		if _, ok := index[id]; !ok {
+			return nil, fmt.Errorf("execution entry node not found: %s", id)
+		}
+	}
+	for _, id := range exits {
+		i, ok := index[id]
+		if !ok {
+			return nil, fmt.Errorf("execution exit node not found: %s", id)
+		}
+		node := &result.Nodes[i]
+		if sinkTypes[node.Type] {
+			return nil, fmt.Errorf("execution exit node %s (%s) has no outputs", id, node.Type)
+		}
+		if len(node.Wires) == 0 {
+			node.Wires = [][]string{{}}
+		}
+		node.Wires[0] = append(node.Wires[0], outID)
+	}
+
+	minX, maxX, maxY := flowBounds(result.Nodes)
+	result.Nodes = append(result.Nodes,
+		types.Node{
+			ID:       inID,
+			Type:     "http in",
+			Name:     "Execute " + flow.ID,
+			Position: types.Position{X: minX, Y: maxY + 60},
+			Wires:    [][]string{append([]string(nil), entries...)},
+			Properties: map[string]interface{}{
+				"url":           client.ExecutionPath(flow.ID),
+				"method":        "post",
+				"upload":        false,
+				"swaggerDoc":    "",
+				ManagedProperty: true,
+			},
+		},
+		types.Node{
+			ID:       outID,
+			Type:     "http response",
+			Name:     "Execution result",
+			Position: types.Position{X: maxX, Y: maxY + 60},
+			Wires:    [][]string{},
+			Properties: map[string]interface{}{
+				"statusCode":    "",
+				"headers":       map[string]interface{}{},
+				ManagedProperty: true,
+			},
+		},
+	)
+	if result.Connections != nil {
+		result.Connections = types.ConnectionsFromWires(result.Nodes)
+	}
+
+	return result, nil
+}
+
+// withoutManagedNodes copies the flow, dropping managed nodes and any wires to them
+func withoutManagedNodes(flow *types.FlowDefinition) *types.FlowDefinition {
+	result := *flow
+	result.Nodes = make([]types.Node, 0, len(flow.Nodes)+2)
+
+	managed := make(map[string]bool)
+	for _, node := range flow.Nodes {
+		if isManaged(node) {
+			managed[node.ID] = true
+		}
+	}
+
+	for _, node := range flow.Nodes {
+		if managed[node.ID] {
+			continue
+		}
+		wires := make([][]string, len(node.Wires))
+		for port, targets := range node.Wires {
+			wires[port] = make([]string, 0, len(targets))
+			for _, target := range targets {
+				if !managed[target] {
+					wires[port] = append(wires[port], target)
+				}
+			}
+		}
+		node.Wires = wires
+		result.Nodes = append(result.Nodes, node)
+	}
+
+	return &result
+}
+
+// isManaged reports whether the node was added by the wrapper
+func isManaged(node types.Node) bool {
+	managed, _ := node.Properties[ManagedProperty].(bool)
+	return managed
+}
+
+// defaultEntryNodes returns the nodes wired from inject nodes, or failing that
+// the nodes nothing is wired into
+func defaultEntryNodes(nodes []types.Node) []string {
+	var entries []string
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		if node.Type != "inject" {
+			continue
+		}
+		for _, targets := range node.Wires {
+			for _, target := range targets {
+				if !seen[target] {
+					seen[target] = true
+					entries = append(entries, target)
+				}
+			}
+		}
+	}
+	if len(entries) > 0 {
+		return entries
+	}
+
+	incoming := make(map[string]bool)
+	for _, node := range nodes {
+		for _, targets := range node.Wires {
+			for _, target := range targets {
+				incoming[target] = true
+			}
+		}
+	}
+	for _, node := range nodes {
+		if !incoming[node.ID] && node.Type != "comment" {
+			entries = append(entries, node.ID)
+		}
+	}
+	return entries
+}
+
+// defaultExitNodes returns the nodes wired into debug nodes, or failing that
+// the nodes with nothing wired out of them
+func defaultExitNodes(nodes []types.Node) []string {
+	debug := make(map[string]bool)
+	for _, node := range nodes {
+		if node.Type == "debug" {
+			debug[node.ID] = true
+		}
+	}
+
+	var exits []string
+	for _, node := range nodes {
+		if sinkTypes[node.Type] || node.Type == "inject" {
+			continue
+		}
+		for _, targets := range node.Wires {
+			if containsAny(targets, debug) {
+				exits = append(exits, node.ID)
+				break
+			}
+		}
+	}
+	if len(exits) > 0 {
+		return exits
+	}
+
+	for _, node := range nodes {
+		if sinkTypes[node.Type] || node.Type == "inject" {
+			continue
+		}
+		if !hasOutgoingWires(node) {
+			exits = append(exits, node.ID)
+		}
+	}
+	return exits
+}
+
+func containsAny(ids []string, set map[string]bool) bool {
+	for _, id := range ids {
+		if set[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOutgoingWires(node types.Node) bool {
+	for _, targets := range node.Wires {
+		if len(targets) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flowBounds returns the horizontal extent and lowest point of the nodes
+func flowBounds(nodes []types.Node) (minX, maxX, maxY float64) {
+	for i, node := range nodes {
+		if i == 0 || node.Position.X < minX {
+			minX = node.Position.X
+		}
+		if node.Position.X > maxX {
+			maxX = node.Position.X
+		}
+		if node.Position.Y > maxY {
+			maxY = node.Position.Y
+		}
+	}
+	return minX, maxX, maxY
+}
@@ -0,0 +1,122 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/internal/client"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// flowFile is the object form of a flows file: the flows with their
+// credentials, as well as the /flows v2 response with its revision
+type flowFile struct {
+	Flows       []map[string]interface{}          `json:"flows"`
+	Credentials map[string]map[string]interface{} `json:"credentials,omitempty"`
+}
+
+// ImportNodeRedJSON reads a flows file exported from the Node-RED editor, or
+// the flows.json of a Node-RED instance, returning one flow per tab. Both the
+// plain node array and an object with "flows" and "credentials" sections are
+// accepted. Config nodes on no tab and subflows no tab uses are returned in a
+// last flow with ID types.GlobalFlowID; every other flow carries the subflow
+// templates its nodes use. Credentials end up in each node's Credentials.
+func ImportNodeRedJSON(r io.Reader) ([]*types.FlowDefinition, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flows: %w", err)
+	}
+
+	var file flowFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &file.Flows)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode flows: %w", err)
+	}
+
+	flows, err := client.GroupFlows(file.Flows, file.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import flows: %w", err)
+	}
+	return flows, nil
+}
+
+// ExportOption customizes ExportNodeRedJSON
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	credentials bool
+}
+
+// WithCredentials exports the nodes' credentials in a "credentials" section,
+// writing an object with "flows" and "credentials" instead of a plain array
+func WithCredentials() ExportOption {
+	return func(o *exportOptions) {
+		o.credentials = true
+	}
+}
+
+// ExportNodeRedJSON writes flows in the format of a Node-RED flows file, which
+// the editor can import: a flat array of tabs, nodes, config nodes and subflow
+// templates. A flow with ID types.GlobalFlowID contributes its config nodes
+// and subflows without a tab. Credentials are left out unless WithCredentials
+// is given, so exports can be checked in safely.
+func ExportNodeRedJSON(w io.Writer, flows []*types.FlowDefinition, opts ...ExportOption) error {
+	var options exportOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
+	reconciled := make([]*types.FlowDefinition, 0, len(flows))
+	for _, flow := range flows {
+		if flow == nil {
+			continue
+		}
+		flow, err := flow.Reconciled()
+		if err != nil {
+			return fmt.Errorf("failed to export flows: %w", err)
+		}
+		reconciled = append(reconciled, flow)
+	}
+
+	file := flowFile{Flows: client.FlattenFlows(reconciled)}
+	for _, node := range file.Flows {
+		credentials, ok := node["credentials"].(map[string]string)
+		if !ok {
+			continue
+		}
+		delete(node, "credentials")
+
+		if options.credentials {
+			if file.Credentials == nil {
+				file.Credentials = make(map[string]map[string]interface{})
+			}
+			section := make(map[string]interface{}, len(credentials))
+			for field, value := range credentials {
+				section[field] = value
+			}
+			id, _ := node["id"].(string)
+			file.Credentials[id] = section
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	var err error
+	if options.credentials {
+		err = encoder.Encode(file)
+	} else {
+		err = encoder.Encode(file.Flows)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write flows: %w", err)
+	}
+	return nil
+}
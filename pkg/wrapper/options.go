@@ -0,0 +1,81 @@
+package wrapper
+
+import (
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/flow"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/layout"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// DeployOption customizes how DeployFlow prepares a flow before sending it to Node-RED
+type DeployOption func(*deployOptions)
+
+// deployOptions collects the settings applied by DeployOption values
+type deployOptions struct {
+	execution      *ExecutionEndpoint
+	deploymentType types.DeploymentType
+	validate       bool
+	layout         *layout.Options
+	globals        []types.Node
+	globalsKnown   bool
+}
+
+// newDeployOptions applies the given options over the defaults
+func newDeployOptions(opts []DeployOption) *deployOptions {
+	options := &deployOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(options)
+		}
+	}
+	return options
+}
+
+// WithExecutionEndpoint injects a managed http in / http response node pair
+// into the flow so that ExecuteFlow can invoke it. Pass a zero
+// ExecutionEndpoint to let the wrapper pick entry and exit nodes.
+func WithExecutionEndpoint(endpoint ExecutionEndpoint) DeployOption {
+	return func(o *deployOptions) {
+		o.execution = &endpoint
+	}
+}
+
+// WithDeploymentType sets the Node-RED-Deployment-Type used by DeployAll, e.g.
+// types.DeployNodes to restart only the nodes that changed. It has no effect
+// on DeployFlow, which always replaces a single flow.
+func WithDeploymentType(deployType types.DeploymentType) DeployOption {
+	return func(o *deployOptions) {
+		o.deploymentType = deployType
+	}
+}
+
+// WithValidation checks each flow with flow.Validate before it is sent and
+// refuses to deploy flows with errors, returning a *flow.ValidationError that
+// matches types.ErrInvalidFlow. Warnings do not block the deploy.
+func WithValidation() DeployOption {
+	return func(o *deployOptions) {
+		o.validate = true
+	}
+}
+
+// WithGlobalConfigs gives WithValidation the global config nodes that flows
+// may refer to. Without it, DeployFlow and Plan read them from Node-RED, and
+// DeployAll takes them from the global flow among the flows deployed.
+func WithGlobalConfigs(configs ...types.Node) DeployOption {
+	return func(o *deployOptions) {
+		o.globals = configs
+		o.globalsKnown = true
+	}
+}
+
+// WithAutoLayout positions the nodes left at Position{0, 0} with layout.Apply
+// before the flow is sent. Pass zero Options for the default spacing.
+func WithAutoLayout(options layout.Options) DeployOption {
+	return func(o *deployOptions) {
+		o.layout = &options
+	}
+}
+
+// validateFlow returns the validation errors of a prepared flow
+func validateFlow(def *types.FlowDefinition, globals []types.Node) error {
+	return flow.Validate(def, globals...).Err()
+}
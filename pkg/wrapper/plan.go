@@ -0,0 +1,252 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/diff"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// OwnerEnvVar is the tab environment variable recording which owner manages a
+// flow. Node-RED keeps only a fixed set of tab properties, so ownership is
+// stored in the tab's env, which survives deploys and edits in the editor.
+const OwnerEnvVar = "YOYO_MANAGED_BY"
+
+// PlanAction is what applying a plan does to a flow
+type PlanAction string
+
+const (
+	ActionCreate PlanAction = "create"
+	ActionUpdate PlanAction = "update"
+	ActionDelete PlanAction = "delete"
+	ActionNoop   PlanAction = "no-op"
+)
+
+// PlannedChange is the action planned for a single flow. Flow is the flow
+// that will be deployed, with the deploy options and ownership applied, and
+// is nil for deletes. Diff describes the changes of an update.
+type PlannedChange struct {
+	Action PlanAction            `json:"action"`
+	FlowID string                `json:"flow_id"`
+	Name   string                `json:"name,omitempty"`
+	Flow   *types.FlowDefinition `json:"-"`
+	Diff   *diff.Result          `json:"diff,omitempty"`
+}
+
+// Plan is the set of changes that brings a Node-RED instance to the desired
+// flows of an owner. Create it with NodeRedWrapper.Plan and carry it out with
+// NodeRedWrapper.Apply.
+type Plan struct {
+	Owner   string          `json:"owner"`
+	Changes []PlannedChange `json:"changes"`
+}
+
+// HasChanges reports whether applying the plan would change anything
+func (p *Plan) HasChanges() bool {
+	for _, change := range p.Changes {
+		if change.Action != ActionNoop {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the plan for review, including the diff of each update
+func (p *Plan) String() string {
+	var b strings.Builder
+	counts := map[PlanAction]int{}
+	for _, change := range p.Changes {
+		counts[change.Action]++
+
+		symbol := map[PlanAction]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-", ActionNoop: " "}[change.Action]
+		fmt.Fprintf(&b, "%s %s flow %s", symbol, change.Action, change.FlowID)
+		if change.Name != "" {
+			fmt.Fprintf(&b, " %q", change.Name)
+		}
+		b.WriteString("\n")
+
+		if change.Diff != nil {
+			// The first line of the diff repeats the flow ID and counts
+			lines := strings.Split(strings.TrimSuffix(change.Diff.Text(), "\n"), "\n")
+			for _, line := range lines[1:] {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "Plan: %d to create, %d to update, %d to delete, %d unchanged\n",
+		counts[ActionCreate], counts[ActionUpdate], counts[ActionDelete], counts[ActionNoop])
+	return b.String()
+}
+
+// Plan compares the desired flows of an owner with the flows deployed in
+// Node-RED. Desired flows that do not exist are created, those that differ
+// are updated, and flows of the owner that are no longer desired are
+// deleted. Flows without the owner's mark, such as those created in the
+// editor, are never touched: a desired flow whose ID is taken by one of them
+// is an error. The deploy options are applied to the desired flows first, so
+// the plan compares what would actually be deployed. Node-RED never returns
+// credentials, so changing only a node's Credentials or the value of a cred
+// env var plans no update; deploy the flow with DeployFlow to rotate them.
+func (w *NodeRedWrapper) Plan(ctx context.Context, owner string, desired []*types.FlowDefinition, opts ...DeployOption) (*Plan, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("owner is required")
+	}
+
+	deployed, err := w.GetFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployed flows: %w", err)
+	}
+	owners := make(map[string]string)
+	var tabs []map[string]interface{}
+	for _, node := range deployed {
+		if node["type"] == "tab" {
+			id, _ := node["id"].(string)
+			owners[id] = tabOwner(node)
+			tabs = append(tabs, node)
+		}
+	}
+
+	plan := &Plan{Owner: owner}
+	options := newDeployOptions(opts)
+	if err := w.loadGlobals(ctx, options); err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(desired))
+	for _, flow := range desired {
+		if flow == nil || flow.ID == "" {
+			return nil, fmt.Errorf("flow ID is required")
+		}
+		if flow.ID == types.GlobalFlowID {
+			return nil, fmt.Errorf("the %s flow is shared by all owners; use DeployGlobalConfigs", types.GlobalFlowID)
+		}
+		if wanted[flow.ID] {
+			return nil, fmt.Errorf("flow %s is listed more than once", flow.ID)
+		}
+		wanted[flow.ID] = true
+
+		prepared, err := w.prepareFlow(flow, options)
+		if err != nil {
+			return nil, fmt.Errorf("flow %s: %w", flow.ID, err)
+		}
+		prepared = withOwner(prepared, owner)
+		change := PlannedChange{FlowID: flow.ID, Name: flow.Name, Flow: prepared}
+
+		current, exists := owners[flow.ID]
+		switch {
+		case !exists:
+			change.Action = ActionCreate
+		case current != owner:
+			return nil, fmt.Errorf("flow %s exists but is not managed by %s", flow.ID, owner)
+		default:
+			live, err := w.GetFlow(ctx, flow.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read flow %s: %w", flow.ID, err)
+			}
+			change.Action = ActionNoop
+			if d := diff.Diff(deployedView(live), deployedView(prepared)); !d.Empty() {
+				change.Action = ActionUpdate
+				change.Diff = d
+			}
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	for _, tab := range tabs {
+		id, _ := tab["id"].(string)
+		if owners[id] == owner && !wanted[id] {
+			name, _ := tab["label"].(string)
+			plan.Changes = append(plan.Changes, PlannedChange{Action: ActionDelete, FlowID: id, Name: name})
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply carries out a plan, deploying created and updated flows and deleting
+// orphaned ones in plan order. It stops at the first failure; the flows
+// before it have been changed, so plan again before retrying.
+func (w *NodeRedWrapper) Apply(ctx context.Context, plan *Plan) error {
+	if plan == nil {
+		return fmt.Errorf("plan is required")
+	}
+
+	c, done := w.acquire()
+	defer done()
+
+	for _, change := range plan.Changes {
+		var err error
+		switch change.Action {
+		case ActionCreate, ActionUpdate:
+			err = c.DeployFlow(ctx, change.Flow)
+		case ActionDelete:
+			err = c.DeleteFlow(ctx, change.FlowID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s flow %s: %w", change.Action, change.FlowID, err)
+		}
+	}
+	return nil
+}
+
+// tabOwner returns the owner recorded in a tab's env, if any
+func tabOwner(tab map[string]interface{}) string {
+	env, _ := tab["env"].([]interface{})
+	for _, item := range env {
+		v, _ := item.(map[string]interface{})
+		if v["name"] == OwnerEnvVar {
+			owner, _ := v["value"].(string)
+			return owner
+		}
+	}
+	return ""
+}
+
+// withOwner returns a copy of the flow whose env marks it as the owner's
+func withOwner(flow *types.FlowDefinition, owner string) *types.FlowDefinition {
+	owned := *flow
+	owned.Env = make([]types.EnvVar, 0, len(flow.Env)+1)
+	for _, env := range flow.Env {
+		if env.Name != OwnerEnvVar {
+			owned.Env = append(owned.Env, env)
+		}
+	}
+	owned.Env = append(owned.Env, types.EnvVar{Name: OwnerEnvVar, Value: owner, Type: "str"})
+	return &owned
+}
+
+// deployedView keeps the parts of a flow that Node-RED returns, so that fields
+// it drops (Label, Version, Metadata...) and credentials, which it never
+// returns, do not show up as changes
+func deployedView(flow *types.FlowDefinition) *types.FlowDefinition {
+	view := &types.FlowDefinition{
+		ID:          flow.ID,
+		Name:        flow.Name,
+		Description: flow.Description,
+		Disabled:    flow.Disabled,
+		Env:         flow.Env,
+		Nodes:       withoutCredentials(flow.Nodes),
+		Configs:     withoutCredentials(flow.Configs),
+		Connections: flow.Connections,
+	}
+	for _, subflow := range flow.Subflows {
+		subflow.Nodes = withoutCredentials(subflow.Nodes)
+		subflow.Configs = withoutCredentials(subflow.Configs)
+		view.Subflows = append(view.Subflows, subflow)
+	}
+	return view
+}
+
+// withoutCredentials returns a copy of the nodes without their credentials
+func withoutCredentials(nodes []types.Node) []types.Node {
+	if nodes == nil {
+		return nil
+	}
+	stripped := make([]types.Node, len(nodes))
+	for i, node := range nodes {
+		node.Credentials = nil
+		stripped[i] = node
+	}
+	return stripped
+}
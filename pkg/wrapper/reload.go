@@ -0,0 +1,224 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/yoyo-mq/go-nodered-wrapper/internal/client"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
+)
+
+// DefaultWatchInterval is how often WatchConfigFile checks the file for changes
+const DefaultWatchInterval = 5 * time.Second
+
+// clientHandle pairs a client with the requests currently using it, so that a
+// replaced client can finish them before it is closed
+type clientHandle struct {
+	client   *client.NodeRedClient
+	inflight sync.WaitGroup
+}
+
+// acquire returns the current client and a function to call once the request
+// using it has finished
+func (w *NodeRedWrapper) acquire() (*client.NodeRedClient, func()) {
+	w.mu.RLock()
+	handle := w.current
+	handle.inflight.Add(1)
+	w.mu.RUnlock()
+
+	return handle.client, handle.inflight.Done
+}
+
+// Reload applies a new configuration without recreating the wrapper. The
+// config is checked with ValidateConfig, then a new client is built from it
+// and swapped in atomically: requests already running finish on the old
+// client, which is closed once they have drained, while new requests use the
+// new one. A session established with Authenticate carries over only while
+// the config keeps the same instance, client ID and scope and does not set
+// its own API key. Subscribers registered with OnConfigChange are notified
+// after the swap.
+func (w *NodeRedWrapper) Reload(config *types.Config) error {
+	if config == nil {
+		return fmt.Errorf("config is required")
+	}
+
+	snapshot := cloneConfig(config)
+	applyConfigDefaults(snapshot)
+	if err := ValidateConfig(snapshot); err != nil {
+		return err
+	}
+	applied := cloneConfig(snapshot)
+
+	newClient, err := client.NewNodeRedClient(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to create Node-RED client: %w", err)
+	}
+
+	w.mu.Lock()
+	old := w.current
+	if sameSession(w.applied, snapshot) && newClient.InheritAuth(old.client) {
+		snapshot.APIKey = newClient.Token().AccessToken
+	}
+	if w.circuitListener != nil {
+		newClient.OnCircuitStateChange(w.circuitListener)
+	}
+	previous := w.config
+	w.current = &clientHandle{client: newClient}
+	w.config = snapshot
+	w.applied = applied
+	subscribers := make([]func(types.ConfigChange), len(w.subscribers))
+	copy(subscribers, w.subscribers)
+	w.mu.Unlock()
+
+	go func() {
+		old.inflight.Wait()
+		old.client.Close()
+	}()
+
+	change := types.ConfigChange{
+		Previous: cloneConfig(previous),
+		Current:  cloneConfig(snapshot),
+		Time:     time.Now(),
+	}
+	for _, fn := range subscribers {
+		fn(change)
+	}
+
+	return nil
+}
+
+// sameSession reports whether a login made under the previous config may be
+// reused under the next one: the session must stay on the same instance with
+// the same client, and the new config must not bring its own API key
+func sameSession(previous, next *types.Config) bool {
+	return previous != nil &&
+		next.APIKey == "" &&
+		next.NodeRedURL == previous.NodeRedURL &&
+		next.ClientID == previous.ClientID &&
+		next.Scope == previous.Scope
+}
+
+// appliedConfig returns the config last given to New or Reload, before any
+// token obtained by Authenticate was recorded in it
+func (w *NodeRedWrapper) appliedConfig() *types.Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.applied
+}
+
+// OnConfigChange registers a function called after every successful Reload
+func (w *NodeRedWrapper) OnConfigChange(fn func(types.ConfigChange)) {
+	if fn == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// WatchConfig reloads the wrapper with every config received on updates. It
+// blocks until updates is closed (returning nil) or ctx is done, so run it in
+// its own goroutine. Configs that fail to apply are reported to onError, if
+// given, and the previous config stays in effect.
+func (w *NodeRedWrapper) WatchConfig(ctx context.Context, updates <-chan *types.Config, onError func(error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case config, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if err := w.Reload(config); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// WatchConfigFile polls a config file every interval (DefaultWatchInterval
+// when zero) and reloads the wrapper with LoadConfig whenever the file holds
+// a config different from the one in effect, including on the first check.
+// It blocks until ctx is done. Files that fail to load are reported to
+// onError, if given, and the previous config stays in effect.
+func (w *NodeRedWrapper) WatchConfigFile(ctx context.Context, path string, interval time.Duration, onError func(error)) error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	var last []byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if onError != nil {
+				onError(fmt.Errorf("failed to read config: %w", err))
+			}
+			continue
+		}
+		if last != nil && bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		config, err := LoadConfig(path)
+		if err == nil && reflect.DeepEqual(config, w.appliedConfig()) {
+			continue
+		}
+		if err == nil {
+			err = w.Reload(config)
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// cloneConfig returns a deep copy of the config so that callers cannot change
+// the settings the wrapper is running with
+func cloneConfig(config *types.Config) *types.Config {
+	if config == nil {
+		return nil
+	}
+
+	clone := *config
+	if config.RetryPolicy != nil {
+		rp := *config.RetryPolicy
+		clone.RetryPolicy = &rp
+	}
+	if config.CircuitBreaker != nil {
+		cb := *config.CircuitBreaker
+		clone.CircuitBreaker = &cb
+	}
+	if config.Logging != nil {
+		logging := *config.Logging
+		clone.Logging = &logging
+	}
+	if config.Monitoring != nil {
+		monitoring := *config.Monitoring
+		clone.Monitoring = &monitoring
+	}
+	if config.Execution != nil {
+		execution := *config.Execution
+		if execution.RetryPolicy != nil {
+			rp := *execution.RetryPolicy
+			execution.RetryPolicy = &rp
+		}
+		clone.Execution = &execution
+	}
+	return &clone
+}
@@ -3,18 +3,26 @@ package wrapper
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/yoyo-mq/go-nodered-wrapper/internal/client"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/layout"
 	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
 )
 
 // NodeRedWrapper provides a high-level interface for managing Node-RED workflows
 type NodeRedWrapper struct {
-	client    *client.NodeRedClient
 	converter WorkflowConverter
 	executor  ExecutionHandler
-	config    *types.Config
+
+	// mu guards the client and config, which Reload replaces
+	mu              sync.RWMutex
+	current         *clientHandle
+	config          *types.Config
+	applied         *types.Config
+	circuitListener func(types.CircuitStateChange)
+	subscribers     []func(types.ConfigChange)
 }
 
 // WorkflowConverter interface for converting workflows to Node-RED format
@@ -30,22 +38,30 @@ type ExecutionHandler interface {
 	OnError(ctx context.Context, err error) error
 }
 
-// New creates a new Node-RED wrapper instance
+// New creates a new Node-RED wrapper instance. The config gets the same
+// defaults and validation as with Reload.
 func New(config *types.Config) (*NodeRedWrapper, error) {
 	if config == nil {
 		return nil, fmt.Errorf("config is required")
 	}
 
-	newClient, err := client.NewNodeRedClient(config)
+	// The wrapper keeps its own copy so later changes by the caller have no effect
+	snapshot := cloneConfig(config)
+	applyConfigDefaults(snapshot)
+	if err := ValidateConfig(snapshot); err != nil {
+		return nil, err
+	}
+	newClient, err := client.NewNodeRedClient(snapshot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Node-RED client: %w", err)
 	}
 
 	return &NodeRedWrapper{
-		client:    newClient,
+		current:   &clientHandle{client: newClient},
 		converter: &DefaultConverter{},
 		executor:  &DefaultExecutor{},
-		config:    config,
+		config:    snapshot,
+		applied:   cloneConfig(snapshot),
 	}, nil
 }
 
@@ -78,7 +94,7 @@ func NewWithExecutor(config *types.Config, executor ExecutionHandler) (*NodeRedW
 }
 
 // DeployFlow deploys a workflow to Node-RED
-func (w *NodeRedWrapper) DeployFlow(ctx context.Context, flow *types.FlowDefinition) error {
+func (w *NodeRedWrapper) DeployFlow(ctx context.Context, flow *types.FlowDefinition, opts ...DeployOption) error {
 	if flow == nil {
 		return fmt.Errorf("flow is required")
 	}
@@ -87,36 +103,106 @@ func (w *NodeRedWrapper) DeployFlow(ctx context.Context, flow *types.FlowDefinit
 		return fmt.Errorf("flow ID is required")
 	}
 
-	return w.client.DeployFlow(ctx, flow)
+	options := newDeployOptions(opts)
+	if err := w.loadGlobals(ctx, options); err != nil {
+		return err
+	}
+
+	prepared, err := w.prepareFlow(flow, options)
+	if err != nil {
+		return err
+	}
+
+	c, done := w.acquire()
+	defer done()
+
+	return c.DeployFlow(ctx, prepared)
+}
+
+// prepareFlow applies the deploy options to a flow, returning the flow that
+// is actually sent to Node-RED. The caller's flow is never modified.
+func (w *NodeRedWrapper) prepareFlow(flow *types.FlowDefinition, options *deployOptions) (*types.FlowDefinition, error) {
+	// The global flow only holds config nodes and subflows
+	if flow.ID == types.GlobalFlowID {
+		if options.validate {
+			return flow, validateFlow(flow, options.globals)
+		}
+		return flow, nil
+	}
+
+	// Layout and the execution endpoint follow wires, so wiring given only
+	// as Connections is turned into wires first
+	flow, err := flow.Reconciled()
+	if err != nil {
+		return nil, err
+	}
+
+	// Laid out first, so the execution endpoint is placed below the flow
+	if options.layout != nil {
+		flow = layout.Apply(flow, *options.layout)
+	}
+
+	if options.execution != nil {
+		injected, err := injectExecutionEndpoint(flow, *options.execution)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add execution endpoint: %w", err)
+		}
+		flow = injected
+	}
+
+	if options.validate {
+		if err := validateFlow(flow, options.globals); err != nil {
+			return nil, err
+		}
+	}
+
+	return flow, nil
 }
 
 // DeployWorkflow deploys a workflow using the converter
-func (w *NodeRedWrapper) DeployWorkflow(ctx context.Context, workflow interface{}) error {
+func (w *NodeRedWrapper) DeployWorkflow(ctx context.Context, workflow interface{}, opts ...DeployOption) error {
 	flow, err := w.converter.ConvertToNodeRedFlow(workflow)
 	if err != nil {
 		return fmt.Errorf("failed to convert workflow: %w", err)
 	}
 
-	return w.DeployFlow(ctx, flow)
+	return w.DeployFlow(ctx, flow, opts...)
 }
 
-// ExecuteFlow triggers a workflow execution
+// ExecuteFlow triggers a workflow execution through the flow's managed
+// http in endpoint; the flow must have been deployed WithExecutionEndpoint.
+// Config.Execution.Timeout bounds the execution when ctx has no deadline.
 func (w *NodeRedWrapper) ExecuteFlow(ctx context.Context, flowID string, input map[string]interface{}) (*types.ExecutionResult, error) {
 	if flowID == "" {
 		return nil, fmt.Errorf("flow ID is required")
 	}
 
+	c, done := w.acquire()
+	defer done()
+
+	// Apply the configured default timeout unless the caller set a deadline
+	w.mu.RLock()
+	execution := w.config.Execution
+	w.mu.RUnlock()
+	if e := execution; e != nil && e.Timeout > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+			defer cancel()
+		}
+	}
+
 	// Pre-execution hook
 	if err := w.executor.PreExecute(ctx, input); err != nil {
 		return nil, fmt.Errorf("pre-execution failed: %w", err)
 	}
 
 	startTime := time.Now()
-	result, err := w.client.ExecuteFlow(ctx, flowID, input)
+	result, err := c.ExecuteFlow(ctx, flowID, input)
 	if err != nil {
 		// Error hook
 		if execErr := w.executor.OnError(ctx, err); execErr != nil {
-			return nil, fmt.Errorf("execution failed and error handler failed: %w (original error: %v)", execErr, err)
+			return nil, fmt.Errorf("execution failed and error handler failed: %w (original error: %w)", execErr, err)
 		}
 		return nil, err
 	}
@@ -148,7 +234,10 @@ func (w *NodeRedWrapper) TriggerNode(ctx context.Context, nodeID string, input m
 		return fmt.Errorf("node ID is required")
 	}
 
-	return w.client.TriggerNode(ctx, nodeID, input)
+	c, done := w.acquire()
+	defer done()
+
+	return c.TriggerNode(ctx, nodeID, input)
 }
 
 // GetFlow retrieves a deployed flow
@@ -157,12 +246,92 @@ func (w *NodeRedWrapper) GetFlow(ctx context.Context, flowID string) (*types.Flo
 		return nil, fmt.Errorf("flow ID is required")
 	}
 
-	return w.client.GetFlow(ctx, flowID)
+	c, done := w.acquire()
+	defer done()
+
+	return c.GetFlow(ctx, flowID)
+}
+
+// GetCredentials reads the credentials Node-RED holds for a node, with
+// secrets replaced by types.CredentialPlaceholder
+func (w *NodeRedWrapper) GetCredentials(ctx context.Context, nodeType, nodeID string) (types.Credentials, error) {
+	if nodeType == "" || nodeID == "" {
+		return nil, fmt.Errorf("node type and ID are required")
+	}
+
+	c, done := w.acquire()
+	defer done()
+
+	return c.GetCredentials(ctx, nodeType, nodeID)
 }
 
 // GetFlows retrieves all deployed flows from Node-RED
 func (w *NodeRedWrapper) GetFlows(ctx context.Context) ([]map[string]interface{}, error) {
-	return w.client.GetFlows(ctx)
+	c, done := w.acquire()
+	defer done()
+
+	return c.GetFlows(ctx)
+}
+
+// GetFlowConfig retrieves all deployed flows together with their revision,
+// for use with DeployAll
+func (w *NodeRedWrapper) GetFlowConfig(ctx context.Context) (*types.FlowConfig, error) {
+	c, done := w.acquire()
+	defer done()
+
+	return c.GetFlowConfig(ctx)
+}
+
+// DeployAll replaces the complete flow configuration of the Node-RED instance.
+// Pass the revision from GetFlowConfig to have the deploy rejected with
+// types.ErrConflict if someone else deployed in the meantime, or an empty
+// revision to overwrite unconditionally. Use WithDeploymentType to restart
+// only modified nodes or flows. The new revision is returned.
+func (w *NodeRedWrapper) DeployAll(ctx context.Context, flows []*types.FlowDefinition, rev string, opts ...DeployOption) (string, error) {
+	options := newDeployOptions(opts)
+	if options.deploymentType == types.DeployReload {
+		return "", fmt.Errorf("reload is not a deploy; use ReloadFlows")
+	}
+	// The deploy replaces the global config nodes with those given here
+	if options.validate && !options.globalsKnown {
+		for _, flow := range flows {
+			if flow != nil && flow.ID == types.GlobalFlowID {
+				options.globals = flow.Configs
+			}
+		}
+		options.globalsKnown = true
+	}
+
+	prepared := make([]*types.FlowDefinition, 0, len(flows))
+	for _, flow := range flows {
+		if flow == nil {
+			return "", fmt.Errorf("flow is required")
+		}
+		if flow.ID == "" {
+			return "", fmt.Errorf("flow ID is required")
+		}
+
+		preparedFlow, err := w.prepareFlow(flow, options)
+		if err != nil {
+			return "", fmt.Errorf("flow %s: %w", flow.ID, err)
+		}
+
+		prepared = append(prepared, preparedFlow)
+	}
+
+	c, done := w.acquire()
+	defer done()
+
+	return c.DeployAll(ctx, prepared, rev, options.deploymentType)
+}
+
+// ReloadFlows restarts all flows from Node-RED's storage without deploying
+// anything, returning the new revision
+func (w *NodeRedWrapper) ReloadFlows(ctx context.Context) (string, error) {
+	c, done := w.acquire()
+	defer done()
+
+	return c.ReloadFlows(ctx)
 }
 
 // DeleteFlow removes a flow from Node-RED
@@ -171,17 +340,45 @@ func (w *NodeRedWrapper) DeleteFlow(ctx context.Context, flowID string) error {
 		return fmt.Errorf("flow ID is required")
 	}
 
-	return w.client.DeleteFlow(ctx, flowID)
+	c, done := w.acquire()
+	defer done()
+
+	return c.DeleteFlow(ctx, flowID)
 }
 
 // HealthCheck checks if Node-RED is healthy
 func (w *NodeRedWrapper) HealthCheck(ctx context.Context) error {
-	return w.client.HealthCheck(ctx)
+	c, done := w.acquire()
+	defer done()
+
+	return c.HealthCheck(ctx)
+}
+
+// OnCircuitStateChange registers a function called whenever a circuit breaker
+// guarding Node-RED calls changes state (closed, open, half-open). It stays
+// registered across Reload.
+func (w *NodeRedWrapper) OnCircuitStateChange(fn func(types.CircuitStateChange)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.circuitListener = fn
+	w.current.client.OnCircuitStateChange(fn)
 }
 
-// GetConfig returns the current configuration
+// CircuitStates returns the current state of each circuit breaker
+func (w *NodeRedWrapper) CircuitStates() map[string]types.CircuitState {
+	c, done := w.acquire()
+	defer done()
+
+	return c.CircuitStates()
+}
+
+// GetConfig returns a snapshot of the current configuration. Changing it has
+// no effect on the wrapper; use Reload to apply a new configuration.
 func (w *NodeRedWrapper) GetConfig() *types.Config {
-	return w.config
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return cloneConfig(w.config)
 }
 
 // SetConverter sets a custom converter
@@ -198,20 +395,92 @@ func (w *NodeRedWrapper) SetExecutor(executor ExecutionHandler) {
 	}
 }
 
-// Authenticate authenticates with Node-RED using username/password
+// AuthInfo reports the admin authentication scheme Node-RED advertises and
+// the prompts its login screen shows
+func (w *NodeRedWrapper) AuthInfo(ctx context.Context) (*types.AuthInfo, error) {
+	c, done := w.acquire()
+	defer done()
+
+	return c.AuthInfo(ctx)
+}
+
+// Authenticate logs in to Node-RED using username/password, requesting the
+// client ID and scope from the config. It does nothing when the admin API is
+// not secured, and returns types.ErrStrategyAuth when Node-RED only supports
+// browser-based login. The credentials are kept so the token is renewed
+// before it expires.
 func (w *NodeRedWrapper) Authenticate(ctx context.Context, username, password string) error {
-	// Call the client's GetAuthToken method directly
-	token, err := w.client.GetAuthToken(ctx, username, password)
+	c, done := w.acquire()
+	defer done()
+
+	info, err := c.AuthInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+
+	switch info.Type {
+	case types.AuthNone:
+		return nil
+	case types.AuthStrategy:
+		return fmt.Errorf("authentication failed: %w", types.ErrStrategyAuth)
+	case types.AuthCredentials:
+	default:
+		return fmt.Errorf("authentication failed: unsupported auth scheme %q", info.Type)
+	}
+
+	token, err := c.GetAuthToken(ctx, username, password)
 	if err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 
 	// Update the config with the token
-	w.config.APIKey = token
+	w.setAPIKey(token)
+	return nil
+}
+
+// SetCredentialsFunc makes the wrapper obtain credentials from fn whenever its
+// access token has to be renewed, instead of reusing those given to Authenticate
+func (w *NodeRedWrapper) SetCredentialsFunc(fn types.CredentialsFunc) {
+	c, done := w.acquire()
+	defer done()
+
+	c.SetCredentialsFunc(fn)
+}
+
+// Token returns the access token currently in use and its expiry
+func (w *NodeRedWrapper) Token() types.AuthToken {
+	c, done := w.acquire()
+	defer done()
+
+	return c.Token()
+}
+
+// Logout revokes the current access token and stops renewing it
+func (w *NodeRedWrapper) Logout(ctx context.Context) error {
+	c, done := w.acquire()
+	defer done()
+
+	if err := c.Logout(ctx); err != nil {
+		return fmt.Errorf("logout failed: %w", err)
+	}
+
+	w.setAPIKey("")
 	return nil
 }
 
+// setAPIKey records the token in use in the config snapshot
+func (w *NodeRedWrapper) setAPIKey(token string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	config := cloneConfig(w.config)
+	config.APIKey = token
+	w.config = config
+}
+
 // GetClient returns the internal Node-RED client (for advanced usage)
 func (w *NodeRedWrapper) GetClient() interface{} {
-	return w.client
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current.client
 }
@@ -1,12 +1,21 @@
 package wrapper
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yoyo-mq/go-nodered-wrapper/pkg/layout"
 	"github.com/yoyo-mq/go-nodered-wrapper/pkg/types"
 )
 
@@ -40,6 +49,14 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid retry attempts",
+			config: &types.Config{
+				NodeRedURL:    "http://localhost:1880",
+				RetryAttempts: -1,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -55,6 +72,14 @@ func TestNew(t *testing.T) {
 			}
 		})
 	}
+	// Defaults are applied as Reload applies them, so the config in effect
+	// matches the same config loaded again
+	wrapper, err := New(&types.Config{NodeRedURL: "http://localhost:1880"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTimeout, wrapper.GetConfig().Timeout)
+	loaded, err := ParseConfig([]byte("node_red:\n  url: \"http://localhost:1880\"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, loaded, wrapper.appliedConfig())
 }
 
 func TestNodeRedWrapper_DeployFlow(t *testing.T) {
@@ -219,3 +244,723 @@ func TestDefaultExecutor(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestInjectExecutionEndpoint(t *testing.T) {
+	flow := &types.FlowDefinition{
+		ID: "exec-flow",
+		Nodes: []types.Node{
+			{ID: "inject-1", Type: "inject", Wires: [][]string{{"function-1"}}},
+			{ID: "function-1", Type: "function", Wires: [][]string{{"debug-1"}}},
+			{ID: "debug-1", Type: "debug", Wires: [][]string{}},
+		},
+	}
+
+	injected, err := injectExecutionEndpoint(flow, ExecutionEndpoint{})
+	require.NoError(t, err)
+	require.Len(t, injected.Nodes, 5)
+
+	in := injected.Nodes[3]
+	out := injected.Nodes[4]
+	assert.Equal(t, "http in", in.Type)
+	assert.Equal(t, "/yoyo/execute/exec-flow", in.Properties["url"])
+	assert.Equal(t, [][]string{{"function-1"}}, in.Wires)
+	assert.Equal(t, "http response", out.Type)
+	assert.Equal(t, [][]string{{"debug-1", out.ID}}, injected.Nodes[1].Wires)
+
+	// The caller's flow is left untouched
+	assert.Len(t, flow.Nodes, 3)
+	assert.Equal(t, [][]string{{"debug-1"}}, flow.Nodes[1].Wires)
+
+	// Injecting again replaces the managed nodes instead of duplicating them
+	again, err := injectExecutionEndpoint(injected, ExecutionEndpoint{})
+	require.NoError(t, err)
+	assert.Equal(t, injected, again)
+
+	_, err = injectExecutionEndpoint(flow, ExecutionEndpoint{ExitNodes: []string{"debug-1"}})
+	assert.Error(t, err)
+}
+
+func TestNodeRedWrapper_ExecuteFlowEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/yoyo/execute/ok-flow":
+			var input map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"echo": input["message"]})
+		case "/yoyo/execute/failing-flow":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("boom"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("Cannot POST " + r.URL.Path))
+		}
+	}))
+	defer server.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	result, err := wrapper.ExecuteFlow(ctx, "ok-flow", map[string]interface{}{"message": "hi"})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.NotEmpty(t, result.ExecutionID)
+	assert.Equal(t, map[string]interface{}{"echo": "hi"}, result.Output)
+	assert.Positive(t, result.Duration)
+
+	result, err = wrapper.ExecuteFlow(ctx, "failing-flow", nil)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "boom")
+
+	_, err = wrapper.ExecuteFlow(ctx, "missing-flow", nil)
+	assert.Error(t, err)
+}
+
+func TestNodeRedWrapper_Authenticate(t *testing.T) {
+	scheme := `{}`
+	var tokenRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/login":
+			_, _ = w.Write([]byte(scheme))
+		case "/auth/token":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&tokenRequest))
+			_, _ = w.Write([]byte(`{"access_token":"abc","token_type":"Bearer","expires_in":3600}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := &types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second, ClientID: "yoyo", Scope: "read"}
+	wrapper, err := New(config)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("no admin auth", func(t *testing.T) {
+		require.NoError(t, wrapper.Authenticate(ctx, "admin", "secret"))
+		assert.Nil(t, tokenRequest)
+		assert.Empty(t, wrapper.GetConfig().APIKey)
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		scheme = `{"type":"credentials","prompts":[{"id":"username","type":"text","label":"Username"},{"id":"password","type":"password","label":"Password"}]}`
+
+		info, err := wrapper.AuthInfo(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, types.AuthCredentials, info.Type)
+		assert.Len(t, info.Prompts, 2)
+
+		require.NoError(t, wrapper.Authenticate(ctx, "admin", "secret"))
+		assert.Equal(t, "yoyo", tokenRequest["client_id"])
+		assert.Equal(t, "read", tokenRequest["scope"])
+		assert.Equal(t, "abc", wrapper.GetConfig().APIKey)
+		assert.Empty(t, config.APIKey)
+	})
+
+	t.Run("strategy", func(t *testing.T) {
+		scheme = `{"type":"strategy","prompts":[{"type":"strategy","label":"Login with SSO","url":"/auth/strategy"}]}`
+
+		err := wrapper.Authenticate(ctx, "admin", "secret")
+		assert.ErrorIs(t, err, types.ErrStrategyAuth)
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("shipped config file", func(t *testing.T) {
+		config, err := LoadConfig(filepath.Join("..", "..", "configs", "config.yaml"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "http://localhost:1880", config.NodeRedURL)
+		assert.Equal(t, 30*time.Second, config.Timeout)
+		assert.Equal(t, 3, config.RetryAttempts)
+		assert.Equal(t, &types.Logging{Level: "info", Format: "json"}, config.Logging)
+		assert.Equal(t, &types.Monitoring{Enabled: true, MetricsPort: 8080, HealthCheckInterval: 30 * time.Second}, config.Monitoring)
+		require.NotNil(t, config.Execution)
+		assert.Equal(t, 60*time.Second, config.Execution.Timeout)
+		assert.Equal(t, &types.RetryPolicy{
+			MaxRetries:    3,
+			InitialDelay:  time.Second,
+			MaxDelay:      30 * time.Second,
+			BackoffFactor: 2,
+		}, config.Execution.RetryPolicy)
+		// The execution policy does not apply to admin API requests
+		assert.Nil(t, config.RetryPolicy)
+		assert.Equal(t, &types.CircuitBreaker{
+			MaxFailures:  5,
+			Timeout:      60 * time.Second,
+			ResetTimeout: 300 * time.Second,
+		}, config.CircuitBreaker)
+
+		wrapper, err := New(config)
+		require.NoError(t, err)
+		assert.NotNil(t, wrapper)
+	})
+
+	t.Run("environment overrides", func(t *testing.T) {
+		t.Setenv("NODERED_URL", "https://nodered.internal:1880")
+		t.Setenv("NODERED_TIMEOUT", "5s")
+		t.Setenv("NODERED_LOG_LEVEL", "debug")
+		t.Setenv("NODERED_CIRCUIT_BREAKER_MAX_FAILURES", "2")
+
+		config, err := LoadConfig(filepath.Join("..", "..", "configs", "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://nodered.internal:1880", config.NodeRedURL)
+		assert.Equal(t, 5*time.Second, config.Timeout)
+		assert.Equal(t, "debug", config.Logging.Level)
+		assert.Equal(t, 2, config.CircuitBreaker.MaxFailures)
+
+		t.Setenv("NODERED_RETRY_ATTEMPTS", "many")
+		_, err = LoadConfig(filepath.Join("..", "..", "configs", "config.yaml"))
+		assert.ErrorContains(t, err, "NODERED_RETRY_ATTEMPTS")
+	})
+
+	t.Run("environment only", func(t *testing.T) {
+		t.Setenv("NODERED_URL", "http://localhost:1880")
+
+		config, err := LoadConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, DefaultTimeout, config.Timeout)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	_, err := ParseConfig([]byte("node_red:\n  url: \"http://localhost:1880\"\n  timeout: 30\n"))
+	assert.ErrorContains(t, err, "invalid duration")
+
+	_, err = ParseConfig([]byte("node_red:\n  url: \"ftp://localhost\"\n  timeout: \"-1s\"\nlogging:\n  level: loud\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "scheme must be http or https")
+	assert.Contains(t, err.Error(), "timeout must be positive")
+	assert.Contains(t, err.Error(), "logging.level")
+
+	_, err = ParseConfig([]byte("node_red:\n  timeout: \"10s\"\n"))
+	assert.ErrorContains(t, err, "node_red.url is required")
+}
+
+func TestNodeRedWrapper_GetConfigSnapshot(t *testing.T) {
+	config := &types.Config{
+		NodeRedURL:  "http://localhost:1880",
+		Timeout:     30 * time.Second,
+		RetryPolicy: &types.RetryPolicy{MaxRetries: 2},
+	}
+	wrapper, err := New(config)
+	require.NoError(t, err)
+
+	snapshot := wrapper.GetConfig()
+	snapshot.NodeRedURL = "http://elsewhere:1880"
+	snapshot.RetryPolicy.MaxRetries = 10
+	config.Timeout = time.Second
+
+	current := wrapper.GetConfig()
+	assert.Equal(t, "http://localhost:1880", current.NodeRedURL)
+	assert.Equal(t, 2, current.RetryPolicy.MaxRetries)
+	assert.Equal(t, 30*time.Second, current.Timeout)
+}
+
+func TestNodeRedWrapper_Reload(t *testing.T) {
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	releaseHandler := func() { releaseOnce.Do(func() { close(release) }) }
+	started := make(chan struct{})
+	oldServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flow/slow" {
+			close(started)
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"id":"slow","label":"old"}`))
+	}))
+	defer oldServer.Close()
+	// Unblock the handler before the server closes, even when an assertion
+	// below stops the test early
+	defer releaseHandler()
+	newServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"fast","label":"new"}`))
+	}))
+	defer newServer.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: oldServer.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var changes []types.ConfigChange
+	wrapper.OnConfigChange(func(change types.ConfigChange) {
+		changes = append(changes, change)
+	})
+
+	// A request in flight on the old client completes after the swap
+	inflight := make(chan *types.FlowDefinition)
+	go func() {
+		flow, err := wrapper.GetFlow(ctx, "slow")
+		assert.NoError(t, err)
+		inflight <- flow
+	}()
+	<-started
+
+	updates := make(chan *types.Config, 2)
+	updates <- &types.Config{NodeRedURL: "not a url"}
+	updates <- &types.Config{NodeRedURL: newServer.URL, Timeout: 5 * time.Second}
+	close(updates)
+
+	var reloadErrs []error
+	require.NoError(t, wrapper.WatchConfig(ctx, updates, func(err error) {
+		reloadErrs = append(reloadErrs, err)
+	}))
+	assert.Len(t, reloadErrs, 1)
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, oldServer.URL, changes[0].Previous.NodeRedURL)
+	assert.Equal(t, newServer.URL, changes[0].Current.NodeRedURL)
+	assert.Equal(t, newServer.URL, wrapper.GetConfig().NodeRedURL)
+
+	flow, err := wrapper.GetFlow(ctx, "fast")
+	require.NoError(t, err)
+	assert.Equal(t, "new", flow.Name)
+
+	releaseHandler()
+	assert.Equal(t, "old", (<-inflight).Name)
+}
+
+func TestNodeRedWrapper_WatchConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("node_red:\n  url: \"http://localhost:1880\"\n"), 0o600))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	wrapper, err := New(config)
+	require.NoError(t, err)
+
+	changed := make(chan types.ConfigChange, 1)
+	wrapper.OnConfigChange(func(change types.ConfigChange) {
+		changed <- change
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = wrapper.WatchConfigFile(ctx, path, 10*time.Millisecond, nil)
+	}()
+
+	require.NoError(t, os.WriteFile(path, []byte("node_red:\n  url: \"http://localhost:1881\"\n  timeout: \"5s\"\n"), 0o600))
+
+	select {
+	case change := <-changed:
+		assert.Equal(t, "http://localhost:1881", change.Current.NodeRedURL)
+		assert.Equal(t, 5*time.Second, wrapper.GetConfig().Timeout)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change not applied")
+	}
+}
+
+func TestNodeRedWrapper_ReloadSession(t *testing.T) {
+	var mu sync.Mutex
+	var logins []string
+	login := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/auth/login":
+				_, _ = w.Write([]byte(`{"type":"credentials"}`))
+			case "/auth/token":
+				mu.Lock()
+				logins = append(logins, name)
+				mu.Unlock()
+				_, _ = w.Write([]byte(`{"access_token":"token-` + name + `","expires_in":3600}`))
+			default:
+				_, _ = w.Write([]byte(`[]`))
+			}
+		}))
+	}
+	first := login("first")
+	defer first.Close()
+	second := login("second")
+	defer second.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: first.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	require.NoError(t, wrapper.Authenticate(context.Background(), "admin", "secret"))
+
+	// Same instance: the session is kept
+	require.NoError(t, wrapper.Reload(&types.Config{NodeRedURL: first.URL, Timeout: time.Second}))
+	assert.Equal(t, "token-first", wrapper.Token().AccessToken)
+
+	// An explicit API key replaces the session
+	require.NoError(t, wrapper.Reload(&types.Config{NodeRedURL: first.URL, Timeout: time.Second, APIKey: "static"}))
+	assert.Equal(t, "static", wrapper.Token().AccessToken)
+	assert.Equal(t, "static", wrapper.GetConfig().APIKey)
+
+	// Another instance never receives the old token or credentials
+	require.NoError(t, wrapper.Authenticate(context.Background(), "admin", "secret"))
+	require.NoError(t, wrapper.Reload(&types.Config{NodeRedURL: second.URL, Timeout: time.Second}))
+	assert.Empty(t, wrapper.Token().AccessToken)
+	_, err = wrapper.GetFlows(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "first"}, logins)
+}
+
+func TestNodeRedWrapper_DeployFlowValidation(t *testing.T) {
+	var deploys int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flow/global" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":      "global",
+				"configs": []map[string]interface{}{{"id": "broker", "type": "mqtt-broker"}},
+			})
+			return
+		}
+		deploys++
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": "tab"})
+	}))
+	defer server.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	invalid := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "dbg", Type: "debug", Wires: [][]string{{"nowhere"}}},
+		},
+	}
+
+	err = wrapper.DeployFlow(ctx, invalid, WithValidation())
+	assert.ErrorIs(t, err, types.ErrInvalidFlow)
+	assert.Equal(t, 0, deploys)
+
+	// Without the option the flow is sent as is
+	require.NoError(t, wrapper.DeployFlow(ctx, invalid))
+	assert.Equal(t, 1, deploys)
+
+	valid := &types.FlowDefinition{
+		ID:    "tab",
+		Nodes: []types.Node{{ID: "fn", Type: "function", Properties: map[string]interface{}{"func": "return msg;"}}},
+	}
+	require.NoError(t, wrapper.DeployFlow(ctx, valid, WithValidation(), WithExecutionEndpoint(ExecutionEndpoint{})))
+	assert.Equal(t, 2, deploys)
+
+	// Config references are checked against the global config nodes in
+	// Node-RED, or those given
+	mqtt := &types.FlowDefinition{
+		ID:    "tab",
+		Nodes: []types.Node{{ID: "sub", Type: "mqtt in", Properties: map[string]interface{}{"broker": "broker"}}},
+	}
+	require.NoError(t, wrapper.DeployFlow(ctx, mqtt, WithValidation()))
+	err = wrapper.DeployFlow(ctx, mqtt, WithValidation(), WithGlobalConfigs())
+	assert.ErrorContains(t, err, "config node broker, which does not exist")
+	assert.Equal(t, 3, deploys)
+}
+
+func TestNodeRedWrapper_DeployFlowAutoLayout(t *testing.T) {
+	var deployed struct {
+		Nodes []map[string]interface{} `json:"nodes"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&deployed))
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": "tab"})
+	}))
+	defer server.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+
+	flow := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "in", Type: "inject", Wires: [][]string{{"fn"}}},
+			{ID: "fn", Type: "function", Properties: map[string]interface{}{"func": "return msg;"}},
+		},
+	}
+	require.NoError(t, wrapper.DeployFlow(context.Background(), flow, WithAutoLayout(layout.Options{})))
+
+	require.Len(t, deployed.Nodes, 2)
+	assert.Equal(t, []interface{}{140.0, 60.0}, []interface{}{deployed.Nodes[0]["x"], deployed.Nodes[0]["y"]})
+	assert.Equal(t, []interface{}{340.0, 60.0}, []interface{}{deployed.Nodes[1]["x"], deployed.Nodes[1]["y"]})
+	assert.Equal(t, types.Position{}, flow.Nodes[0].Position)
+}
+
+func TestNodeRedWrapper_DeployFlowConnections(t *testing.T) {
+	var deployed struct {
+		Nodes []map[string]interface{} `json:"nodes"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&deployed))
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": "tab"})
+	}))
+	defer server.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+
+	// Wired only through Connections
+	flow := &types.FlowDefinition{
+		ID: "tab",
+		Nodes: []types.Node{
+			{ID: "in", Type: "inject"},
+			{ID: "fn", Type: "function", Properties: map[string]interface{}{"func": "return msg;"}},
+		},
+		Connections: []types.Connection{{Source: "in", Target: "fn"}},
+	}
+	require.NoError(t, wrapper.DeployFlow(context.Background(), flow, WithAutoLayout(layout.Options{}), WithExecutionEndpoint(ExecutionEndpoint{})))
+
+	inID, outID := executionNodeIDs("tab")
+	nodes := map[string]map[string]interface{}{}
+	for _, node := range deployed.Nodes {
+		nodes[node["id"].(string)] = node
+	}
+	require.Len(t, nodes, 4)
+	assert.Equal(t, []interface{}{[]interface{}{"fn"}}, nodes["in"]["wires"])
+	assert.Equal(t, []interface{}{[]interface{}{outID}}, nodes["fn"]["wires"], "the function is the exit, not the inject")
+	assert.Equal(t, []interface{}{[]interface{}{"fn"}}, nodes[inID]["wires"], "the entry is the node the inject feeds")
+	assert.Equal(t, []interface{}{140.0, 340.0}, []interface{}{nodes["in"]["x"], nodes["fn"]["x"]})
+	assert.Nil(t, flow.Nodes[0].Wires, "the caller's flow is not modified")
+}
+
+// fakeTabs stands in for the Node-RED flow API, keeping the tabs deployed
+// through /flow/:id
+type fakeTabs struct {
+	mu     sync.Mutex
+	tabs   map[string]map[string]interface{}
+	global map[string]interface{}
+	log    []string
+}
+
+func (f *fakeTabs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/flow/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/flows":
+		var flows []interface{}
+		for _, tab := range f.tabs {
+			flows = append(flows, map[string]interface{}{"id": tab["id"], "type": "tab", "label": tab["label"], "env": tab["env"]})
+			nodes, _ := tab["nodes"].([]interface{})
+			flows = append(flows, nodes...)
+		}
+		if configs, ok := f.global["configs"].([]interface{}); ok {
+			flows = append(flows, configs...)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"rev": "1", "flows": flows})
+	case r.Method == http.MethodGet && id == "global":
+		_ = json.NewEncoder(w).Encode(f.global)
+	case r.Method == http.MethodPut && id == "global":
+		_ = json.NewDecoder(r.Body).Decode(&f.global)
+		f.log = append(f.log, "PUT global")
+	case r.Method == http.MethodGet:
+		_ = json.NewEncoder(w).Encode(f.tabs[id])
+	case r.Method == http.MethodPut && f.tabs[id] == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		var tab map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&tab)
+		f.tabs[tab["id"].(string)] = tab
+		f.log = append(f.log, r.Method+" "+tab["id"].(string))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": tab["id"]})
+	case r.Method == http.MethodDelete:
+		delete(f.tabs, id)
+		f.log = append(f.log, "DELETE "+id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestNodeRedWrapper_PlanApply(t *testing.T) {
+	fake := &fakeTabs{tabs: map[string]map[string]interface{}{
+		"manual": {"id": "manual", "label": "Made in the editor"},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	flowA := &types.FlowDefinition{ID: "a", Name: "A", Nodes: []types.Node{{ID: "a1", Type: "debug"}}}
+	flowB := &types.FlowDefinition{ID: "b", Name: "B", Nodes: []types.Node{{ID: "b1", Type: "debug"}}}
+
+	plan, err := wrapper.Plan(ctx, "ci", []*types.FlowDefinition{flowA, flowB})
+	require.NoError(t, err)
+	assert.Equal(t, []PlanAction{ActionCreate, ActionCreate}, actions(plan))
+	require.NoError(t, wrapper.Apply(ctx, plan))
+	assert.Equal(t, []string{"POST a", "POST b"}, fake.log)
+
+	// Applying again changes nothing
+	plan, err = wrapper.Plan(ctx, "ci", []*types.FlowDefinition{flowA, flowB})
+	require.NoError(t, err)
+	assert.False(t, plan.HasChanges(), plan.String())
+
+	// Change a, drop b; the manual tab is left alone
+	changed := *flowA
+	changed.Nodes = []types.Node{{ID: "a1", Type: "debug", Name: "renamed"}}
+	plan, err = wrapper.Plan(ctx, "ci", []*types.FlowDefinition{&changed})
+	require.NoError(t, err)
+	assert.Equal(t, []PlanAction{ActionUpdate, ActionDelete}, actions(plan))
+	assert.Equal(t, `~ update flow a "A"
+    ~ node a1 (debug "renamed")
+    ~   name: "" -> "renamed"
+- delete flow b "B"
+Plan: 0 to create, 1 to update, 1 to delete, 0 unchanged
+`, plan.String())
+
+	fake.log = nil
+	require.NoError(t, wrapper.Apply(ctx, plan))
+	assert.Equal(t, []string{"PUT a", "DELETE b"}, fake.log)
+	assert.Contains(t, fake.tabs, "manual")
+
+	// Tabs of other owners are never taken over
+	_, err = wrapper.Plan(ctx, "ci", []*types.FlowDefinition{{ID: "manual"}})
+	assert.ErrorContains(t, err, "not managed by ci")
+	plan, err = wrapper.Plan(ctx, "other", nil)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+}
+
+func actions(plan *Plan) []PlanAction {
+	var result []PlanAction
+	for _, change := range plan.Changes {
+		result = append(result, change.Action)
+	}
+	return result
+}
+
+// editorExport is a flows file as exported from the Node-RED editor
+const editorExport = `{
+    "flows": [
+        {"id": "t1", "type": "tab", "label": "Ingest", "disabled": false, "info": "reads sensors"},
+        {"id": "t2", "type": "tab", "label": "Report", "disabled": true, "info": ""},
+        {"id": "sf1", "type": "subflow", "name": "Clean", "in": [{"x": 50, "y": 30, "wires": [{"id": "sf1-fn"}]}], "out": [{"x": 250, "y": 30, "wires": [{"id": "sf1-fn", "port": 0}]}]},
+        {"id": "sf1-fn", "type": "function", "z": "sf1", "func": "return msg;", "outputs": 1, "x": 150, "y": 30, "wires": [[]]},
+        {"id": "sf2", "type": "subflow", "name": "Unused", "in": [], "out": []},
+        {"id": "broker", "type": "mqtt-broker", "name": "Broker", "broker": "localhost", "port": "1883"},
+        {"id": "in", "type": "mqtt in", "z": "t1", "topic": "sensors/#", "broker": "broker", "x": 100, "y": 80, "wires": [["clean"]]},
+        {"id": "clean", "type": "subflow:sf1", "z": "t1", "env": [{"name": "LEVEL", "value": "2", "type": "num"}], "x": 260, "y": 80, "wires": [["out"]]},
+        {"id": "out", "type": "debug", "z": "t1", "active": true, "x": 420, "y": 80, "wires": []},
+        {"id": "ui", "type": "ui_group", "z": "t2", "name": "Charts"},
+        {"id": "grp", "type": "group", "z": "t2", "nodes": ["chart"], "x": 74, "y": 39, "w": 232, "h": 82},
+        {"id": "chart", "type": "ui_chart", "z": "t2", "g": "grp", "group": "ui", "x": 190, "y": 80, "wires": [[]]}
+    ],
+    "credentials": {"broker": {"user": "svc", "password": "secret"}}
+}`
+
+func TestImportExportNodeRedJSON(t *testing.T) {
+	flows, err := ImportNodeRedJSON(strings.NewReader(editorExport))
+	require.NoError(t, err)
+	require.Len(t, flows, 3)
+
+	ingest, report, global := flows[0], flows[1], flows[2]
+	assert.Equal(t, "t1", ingest.ID)
+	assert.Equal(t, "Ingest", ingest.Name)
+	assert.Equal(t, "reads sensors", ingest.Description)
+	assert.Equal(t, []string{"in", "clean", "out"}, nodeIDs(ingest.Nodes))
+	assert.Equal(t, [][]string{{"clean"}}, ingest.Nodes[0].Wires)
+	require.Len(t, ingest.Subflows, 1, "the tab carries the subflow its instance uses")
+	assert.Equal(t, "sf1", ingest.Subflows[0].ID)
+	assert.Equal(t, []types.SubflowPort{{Position: types.Position{X: 250, Y: 30}, Wires: []types.SubflowWire{{ID: "sf1-fn"}}}}, ingest.Subflows[0].Out)
+	assert.Equal(t, []string{"sf1-fn"}, nodeIDs(ingest.Subflows[0].Nodes))
+
+	assert.True(t, report.Disabled)
+	assert.Equal(t, []string{"grp", "chart"}, nodeIDs(report.Nodes))
+	assert.Equal(t, []string{"ui"}, nodeIDs(report.Configs))
+
+	assert.Equal(t, types.GlobalFlowID, global.ID)
+	assert.Equal(t, []string{"broker"}, nodeIDs(global.Configs))
+	assert.Equal(t, types.Credentials{"user": "svc", "password": "secret"}, global.Configs[0].Credentials)
+	require.Len(t, global.Subflows, 1)
+	assert.Equal(t, "sf2", global.Subflows[0].ID)
+
+	// Credentials are only exported on request
+	var plain bytes.Buffer
+	require.NoError(t, ExportNodeRedJSON(&plain, flows))
+	assert.NotContains(t, plain.String(), "secret")
+	assert.Equal(t, "[", plain.String()[:1])
+
+	var withCredentials bytes.Buffer
+	require.NoError(t, ExportNodeRedJSON(&withCredentials, flows, WithCredentials()))
+	assert.Contains(t, withCredentials.String(), `"credentials": {`)
+
+	// Re-importing the export gives the same flows
+	again, err := ImportNodeRedJSON(&withCredentials)
+	require.NoError(t, err)
+	assert.Equal(t, flows, again)
+
+	var nodes []map[string]interface{}
+	require.NoError(t, json.Unmarshal(plain.Bytes(), &nodes))
+	byID := make(map[string]map[string]interface{})
+	for _, node := range nodes {
+		byID[node["id"].(string)] = node
+	}
+	assert.Len(t, nodes, 12)
+	assert.NotContains(t, byID["broker"], "z", "global config nodes have no tab")
+	assert.NotContains(t, byID["ui"], "x", "config nodes have no position")
+	assert.Equal(t, "t2", byID["ui"]["z"])
+	assert.Equal(t, "sf1", byID["sf1-fn"]["z"])
+
+	_, err = ImportNodeRedJSON(strings.NewReader(`[{"id": "n", "type": "debug", "z": "nowhere", "x": 1, "y": 1}]`))
+	assert.ErrorContains(t, err, "unknown flow nowhere")
+}
+
+func nodeIDs(nodes []types.Node) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	return ids
+}
+
+func TestNodeRedWrapper_GlobalConfigs(t *testing.T) {
+	fake := &fakeTabs{
+		tabs: map[string]map[string]interface{}{},
+		global: map[string]interface{}{
+			"id":      "global",
+			"configs": []interface{}{map[string]interface{}{"id": "manual", "type": "tls-config"}},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	wrapper, err := New(&types.Config{NodeRedURL: server.URL, Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	brokers := []types.Node{
+		{ID: "broker", Type: "mqtt-broker", Properties: map[string]interface{}{"broker": "localhost", "tls": "manual"}},
+		{ID: "spare", Type: "mqtt-broker", Properties: map[string]interface{}{"broker": "backup"}},
+	}
+	require.NoError(t, wrapper.DeployGlobalConfigs(ctx, "ci", brokers))
+
+	global, err := wrapper.GetFlow(ctx, types.GlobalFlowID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"manual", "broker", "spare"}, nodeIDs(global.Configs))
+	assert.Equal(t, "ci", global.Configs[1].Properties[ConfigOwnerProperty])
+	for _, config := range fake.global["configs"].([]interface{}) {
+		assert.NotContains(t, config, "z", "global config nodes are on no tab")
+	}
+
+	err = wrapper.DeployGlobalConfigs(ctx, "ci", []types.Node{{ID: "manual", Type: "tls-config"}})
+	assert.ErrorContains(t, err, "not managed by ci")
+
+	// A flow using the broker keeps it; the spare one is collected
+	flow := &types.FlowDefinition{
+		ID:    "tab",
+		Nodes: []types.Node{{ID: "sub", Type: "mqtt in", Properties: map[string]interface{}{"broker": "broker", "topic": "a"}}},
+	}
+	require.NoError(t, wrapper.DeployFlow(ctx, flow, WithValidation()))
+
+	removed, err := wrapper.CollectConfigs(ctx, "ci")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"spare"}, removed)
+
+	global, err = wrapper.GetFlow(ctx, types.GlobalFlowID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"manual", "broker"}, nodeIDs(global.Configs))
+
+	removed, err = wrapper.CollectConfigs(ctx, "other")
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}